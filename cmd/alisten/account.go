@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/bihua-university/alisten/internal/auth"
+	"github.com/bihua-university/alisten/internal/base"
+)
+
+var accounts *auth.Accounts
+
+// secret 登录令牌的签名密钥，其他签名密钥由它派生
+var secret []byte
+
+func initAccounts() {
+	secret = []byte(base.Config.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+		slog.Warn("auth.secret is not configured, sessions will be invalidated on restart")
+	}
+	accounts = auth.NewAccounts(store, secret)
+}
+
+// accountResponse 注册和登录接口的返回值
+func accountResponse(a *auth.Account, token string) base.H {
+	return base.H{
+		"token": token,
+		"user":  a.User(),
+	}
+}
+
+func writeAccountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrAccountExists):
+		writeJSON(w, http.StatusConflict, base.H{"error": err.Error()})
+	case errors.Is(err, auth.ErrInvalidAccount):
+		writeJSON(w, http.StatusBadRequest, base.H{"error": err.Error()})
+	case errors.Is(err, auth.ErrInvalidPassword), errors.Is(err, auth.ErrInvalidSession):
+		writeJSON(w, http.StatusUnauthorized, base.H{"error": err.Error()})
+	default:
+		slog.Error("account", "error", err)
+		writeJSON(w, http.StatusInternalServerError, base.H{"error": "服务器内部错误"})
+	}
+}
+
+func registerHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, base.H{"error": err.Error()})
+		return
+	}
+
+	a, token, err := accounts.Register(r.Context(), request.Name, request.Email, request.Password)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, accountResponse(a, token))
+}
+
+func loginHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, base.H{"error": err.Error()})
+		return
+	}
+
+	a, token, err := accounts.Login(r.Context(), request.Name, request.Password)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, accountResponse(a, token))
+}
+
+// sessionToken 从 Authorization 头中读取登录令牌
+func sessionToken(r *http.Request) string {
+	const bearerPrefix = "Bearer "
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, bearerPrefix) {
+		return h[len(bearerPrefix):]
+	}
+	return ""
+}
+
+// resolveUser 解析登录令牌，token 为空时返回 nil 表示游客
+func resolveUser(r *http.Request, token string) (*auth.User, error) {
+	if token == "" {
+		return nil, nil
+	}
+	u, err := accounts.Resolve(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// guestName 游客的显示名称，附带打码后的 IP 以区分同名用户
+func guestName(name, ip string) string {
+	if name == "" {
+		return "游客(" + ip + ")"
+	}
+	return name + "(" + ip + ")"
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// closeHouseClosed 房间被管理员关闭时 WebSocket 的关闭码
+const closeHouseClosed = 4002
+
+// adminOnly 要求请求携带配置中的管理令牌，未配置令牌时拒绝所有请求
+func adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := base.Current().Token
+		if expected == "" {
+			writeJSON(w, http.StatusForbidden, base.H{"error": "未配置管理令牌"})
+			return
+		}
+		token := sessionToken(r)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, base.H{"error": "未授权"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// registerAdmin 注册管理接口，所有接口都需要管理令牌
+func registerAdmin(mux *http.ServeMux) {
+	handle := func(pattern string, fn http.HandlerFunc) {
+		mux.Handle(pattern, adminOnly(fn))
+	}
+	handle("GET /admin/houses", adminListHouses)
+	handle("POST /admin/houses", adminCreateHouse)
+	handle("PATCH /admin/houses/{id}", adminUpdateHouse)
+	handle("DELETE /admin/houses/{id}", adminDeleteHouse)
+	handle("POST /admin/houses/{id}/close", adminCloseHouse)
+	handle("GET /admin/houses/{id}/connections", adminHouseConnections)
+	handle("POST /admin/broadcast", adminBroadcast)
+}
+
+// adminHouse 管理接口中房间的完整状态
+func (h *House) adminHouse() base.H {
+	var data base.H
+	h.lock(func() {
+		data = base.H{
+			"state":      h.snapshot(),
+			"limits":     h.effectiveLimits(),
+			"online":     len(h.Connection),
+			"lastActive": h.lastActiveTime.UnixMilli(),
+		}
+	})
+	return data
+}
+
+// adminTarget 根据路径中的 id 查找房间，房间不存在时返回 404
+func adminTarget(w http.ResponseWriter, r *http.Request) *House {
+	h := GetHouse(r.PathValue("id"))
+	if h == nil {
+		writeJSON(w, http.StatusNotFound, base.H{"error": "房间不存在"})
+	}
+	return h
+}
+
+func adminListHouses(w http.ResponseWriter, r *http.Request) {
+	list := allHouses()
+	response := make([]base.H, 0, len(list))
+	for _, h := range list {
+		response = append(response, h.adminHouse())
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func adminCreateHouse(w http.ResponseWriter, r *http.Request) {
+	request := struct {
+		ID       string      `json:"id"`
+		Name     string      `json:"name"`
+		Desc     string      `json:"desc"`
+		Password string      `json:"password"`
+		Owner    string      `json:"owner"`
+		Ultimate bool        `json:"ultimate"`
+		Limits   base.Limits `json:"limits"`
+	}{Ultimate: true}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, base.H{"error": err.Error()})
+		return
+	}
+	if err := request.Limits.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, base.H{"error": err.Error()})
+		return
+	}
+	if shuttingDown.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, base.H{"error": "服务器正在重启"})
+		return
+	}
+	if request.ID == "" {
+		request.ID = uuid.New().String()
+	}
+	if GetHouse(request.ID) != nil {
+		writeJSON(w, http.StatusConflict, base.H{"error": "房间已存在"})
+		return
+	}
+
+	state := &storage.House{Limits: request.Limits}
+	createHouse(request.ID, request.Name, request.Desc, request.Password, request.Owner, request.Ultimate, state)
+	writeJSON(w, http.StatusOK, GetHouse(request.ID).adminHouse())
+}
+
+func adminUpdateHouse(w http.ResponseWriter, r *http.Request) {
+	h := adminTarget(w, r)
+	if h == nil {
+		return
+	}
+	var request struct {
+		Password *string      `json:"password"`
+		Owner    *string      `json:"owner"`
+		Ultimate *bool        `json:"ultimate"`
+		Limits   *base.Limits `json:"limits"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, base.H{"error": err.Error()})
+		return
+	}
+	if request.Limits != nil {
+		if err := request.Limits.Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, base.H{"error": err.Error()})
+			return
+		}
+	}
+
+	h.lock(func() {
+		if request.Password != nil {
+			h.Password = *request.Password
+		}
+		if request.Owner != nil {
+			h.Owner = *request.Owner
+		}
+		if request.Ultimate != nil {
+			h.ultimate = *request.Ultimate
+		}
+		if request.Limits != nil {
+			h.limits = *request.Limits
+		}
+		h.applyLimits()
+	})
+	h.save()
+	h.pushSettings()
+	writeJSON(w, http.StatusOK, h.adminHouse())
+}
+
+// shutdown 断开房间的所有连接并停止房间，forget 为 true 时同时删除已保存的状态
+func (h *House) shutdown(code int, reason string, forget bool) {
+	if !h.stop() {
+		return
+	}
+	var conns []*Connection
+	h.lock(func() {
+		conns = append(conns, h.Connection...)
+	})
+	for _, conn := range conns {
+		conn.Close(code, reason)
+	}
+	if forget {
+		h.forget()
+	}
+}
+
+func adminDeleteHouse(w http.ResponseWriter, r *http.Request) {
+	h := adminTarget(w, r)
+	if h == nil {
+		return
+	}
+	h.shutdown(closeHouseClosed, "house deleted", true)
+	writeJSON(w, http.StatusOK, base.H{"message": "房间已删除"})
+}
+
+// adminCloseHouse 强制关闭房间，持久化房间的状态会保留，重启后恢复
+func adminCloseHouse(w http.ResponseWriter, r *http.Request) {
+	h := adminTarget(w, r)
+	if h == nil {
+		return
+	}
+	var ultimate bool
+	h.lock(func() {
+		ultimate = h.ultimate
+	})
+	h.shutdown(closeHouseClosed, "house closed", !ultimate)
+	writeJSON(w, http.StatusOK, base.H{"message": "房间已关闭"})
+}
+
+func adminHouseConnections(w http.ResponseWriter, r *http.Request) {
+	h := adminTarget(w, r)
+	if h == nil {
+		return
+	}
+	response := make([]base.H, 0)
+	h.lock(func() {
+		for _, conn := range h.Connection {
+			u := conn.GetUser()
+			response = append(response, base.H{
+				"id":   conn.id,
+				"ip":   conn.ip,
+				"user": u,
+				"role": h.roleOf(u).String(),
+			})
+		}
+	})
+	writeJSON(w, http.StatusOK, response)
+}
+
+// adminBroadcast 向指定房间或所有房间广播系统消息
+func adminBroadcast(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		HouseID string `json:"houseId"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, base.H{"error": err.Error()})
+		return
+	}
+	if request.Message == "" {
+		writeJSON(w, http.StatusBadRequest, base.H{"error": "消息不能为空"})
+		return
+	}
+
+	var targets []*House
+	housesMu.Lock()
+	for id, h := range houses {
+		if request.HouseID == "" || request.HouseID == id {
+			targets = append(targets, h)
+		}
+	}
+	housesMu.Unlock()
+	if request.HouseID != "" && len(targets) == 0 {
+		writeJSON(w, http.StatusNotFound, base.H{"error": "房间不存在"})
+		return
+	}
+
+	msg := base.H{
+		"type":      "info/push",
+		"info":      request.Message,
+		"system":    true,
+		"timestamp": time.Now().UnixMilli(),
+	}
+	for _, h := range targets {
+		h.Broadcast(msg)
+	}
+	writeJSON(w, http.StatusOK, base.H{"houses": len(targets)})
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/bihua-university/alisten/internal/auth"
@@ -9,6 +8,10 @@ import (
 )
 
 func chat(c *Context) {
+	if c.house.Muted(c.conn.GetUser(), c.conn.ip) {
+		c.Info("你已被禁言")
+		return
+	}
 	// 转发所有消息
 	msg := base.H{
 		"type":     "chat",
@@ -30,6 +33,9 @@ func (c *Context) Chat(msg string) {
 }
 
 func (c *Context) Info(msg string) {
+	if c.conn == nil {
+		return
+	}
 	h := base.H{
 		"type": "info/push",
 		"info": msg,
@@ -37,6 +43,14 @@ func (c *Context) Info(msg string) {
 	c.conn.Send(h)
 }
 
+// Fail 通知用户操作失败，WebSocket 推送 info/push，HTTP 返回 status 状态码
+func (c *Context) Fail(status int, msg string) {
+	c.Info(msg)
+	if c.IsHTTP() {
+		writeJSON(c.hw, status, base.H{"error": msg})
+	}
+}
+
 func setUser(c *Context) {
 	name := c.Get("name").String()
 	email := c.Get("email").String()
@@ -45,13 +59,13 @@ func setUser(c *Context) {
 	delay := sendTime - time.Now().UnixMilli()
 
 	c.conn.mu.Lock()
-	// 更新用户信息
-	if email != "" {
-		c.conn.user.Email = auth.EmailToMD5(email)
-		c.conn.user.Name = name
-	} else {
-		c.conn.user.Name = fmt.Sprintf("%s(%s)", name, c.conn.ip)
+	// 已登录的用户以账号信息为准，游客的名称附带 IP 避免冒充他人
+	if c.conn.user.IsGuest() {
+		c.conn.user.Name = guestName(name, c.conn.ip)
 		c.conn.user.Email = ""
+		if email != "" {
+			c.conn.user.Email = auth.EmailToMD5(email)
+		}
 	}
 	c.conn.mu.Unlock()
 
@@ -2,9 +2,11 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 
 	"github.com/bihua-university/alisten/internal/auth"
 	"github.com/bihua-university/alisten/internal/base"
@@ -15,10 +17,26 @@ import (
 )
 
 type Context struct {
-	conn  *Connection
-	hw    http.ResponseWriter
-	house *House
-	data  gjson.Result
+	conn    *Connection
+	hw      http.ResponseWriter
+	ip      string     // HTTP 请求打码后的 IP
+	addr    string     // HTTP 请求未打码的 IP，用于区分游客
+	account *auth.User // HTTP 请求登录的用户，游客为 nil
+	house   *House
+	action  string // 请求的 action 或 HTTP 路径
+	data    gjson.Result
+}
+
+// Logger 返回带有房间、连接、用户和 action 字段的日志
+func (c *Context) Logger() *slog.Logger {
+	l := slog.Default()
+	if c.house != nil {
+		l = l.With(base.LogHouse, c.house.ID)
+	}
+	if c.conn != nil {
+		l = l.With(base.LogConn, c.conn.id)
+	}
+	return l.With(base.LogUser, c.User().Name, base.LogAction, c.action)
 }
 
 func (c *Context) Get(p string) gjson.Result {
@@ -44,9 +62,12 @@ func (c *Context) User() auth.User {
 		return c.conn.GetUser()
 	}
 	if c.IsHTTP() {
+		if c.account != nil {
+			return *c.account
+		}
 		email := c.Get("user.email").String()
 		u := auth.User{
-			Name:  c.Get("user.name").String(),
+			Name:  guestName(c.Get("user.name").String(), c.ip),
 			Email: "",
 		}
 		if email != "" {
@@ -57,6 +78,16 @@ func (c *Context) User() auth.User {
 	return auth.User{}
 }
 
+// GuestID 返回区分游客的标识，WebSocket 游客按连接区分，HTTP 游客按未打码的 IP 区分
+//
+// 打码后的 IP 只保留前两段，同一网段的游客会共用同一个 IP，只能用于显示和封禁。
+func (c *Context) GuestID() string {
+	if c.IsWebSocket() {
+		return c.conn.guest
+	}
+	return "addr:" + c.addr
+}
+
 func (c *Context) Send(j any) {
 	if c.conn != nil {
 		c.conn.Send(j)
@@ -75,16 +106,26 @@ func (c *Context) Broadcast(j any) {
 	}
 }
 
+var connID atomic.Uint64
+
 type Connection struct {
-	ip   string
-	send syncx.UnboundedChan[[]byte]
+	id    string
+	ip    string
+	guest string // 游客的标识，每个连接不同
+	send  syncx.UnboundedChan[[]byte]
 
-	mu   sync.Mutex
-	user auth.User
+	mu     sync.Mutex
+	user   auth.User
+	closed bool // send 已关闭，之后的消息直接丢弃
 
 	conn *websocket.Conn
 }
 
+// newConnectionID 生成连接 ID，用于在日志中区分连接
+func newConnectionID() string {
+	return strconv.FormatUint(connID.Add(1), 10)
+}
+
 func (c *Connection) Start() {
 	go func() {
 		for x := range c.send.Out() {
@@ -108,9 +149,25 @@ func (c *Connection) Send(j any) {
 	c.SendRaw(encJson(j))
 }
 
+// SendRaw 发送消息，连接离开房间后发送的消息会被丢弃
+//
+// 后台点歌等操作可能在连接断开后才返回结果，不能向已关闭的 send 发送。
 func (c *Connection) SendRaw(j []byte) {
-	if base.Config.Debug {
-		fmt.Println("[DEBUG][OUT]:", string(j))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
 	}
+	slog.Debug("send", base.LogConn, c.id, "data", string(j))
 	c.send.In() <- j
 }
+
+// closeSend 关闭 send，写循环发送完剩余消息后退出
+func (c *Connection) closeSend() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.send.In())
+	}
+}
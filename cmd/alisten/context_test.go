@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bihua-university/alisten/internal/syncx"
+)
+
+// TestSendAfterLeave 连接离开房间后发送消息不应 panic
+func TestSendAfterLeave(t *testing.T) {
+	c := &Connection{send: syncx.NewUnboundedChan[[]byte](1)}
+	c.SendRaw([]byte("a"))
+	c.closeSend()
+	c.closeSend()
+	c.SendRaw([]byte("b"))
+
+	var got []string
+	for b := range c.send.Out() {
+		got = append(got, string(b))
+	}
+	if len(got) != 1 || got[0] != "a" {
+		t.Errorf("sent %v, want [a]", got)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/music"
+)
+
+type musicErrorInfo struct {
+	code   string
+	status int
+	msg    string
+}
+
+var musicErrors = map[error]musicErrorInfo{
+	music.ErrCopyright:    {"copyright_restricted", http.StatusUnavailableForLegalReasons, "歌曲因版权限制无法播放"},
+	music.ErrVIP:          {"vip_only", http.StatusPaymentRequired, "歌曲需要会员才能播放"},
+	music.ErrRateLimited:  {"rate_limited", http.StatusTooManyRequests, "音乐源请求过于频繁，请稍后再试"},
+	music.ErrTimeout:      {"timeout", http.StatusGatewayTimeout, "音乐源请求超时，请稍后再试"},
+	music.ErrNotFound:     {"not_found", http.StatusNotFound, "未找到对应音乐"},
+	music.ErrNotSupported: {"not_supported", http.StatusBadRequest, "音乐源不支持该操作"},
+	music.ErrUpstream:     {"upstream_unavailable", http.StatusBadGateway, "音乐源暂时不可用，请稍后再试"},
+}
+
+// musicError 返回音乐源错误对应的错误码、HTTP 状态码和提示信息
+func musicError(err error) musicErrorInfo {
+	return musicErrors[music.ErrorKind(err)]
+}
+
+// Error 向用户返回音乐源错误，WebSocket 推送 info/push，HTTP 返回对应的状态码
+func (c *Context) Error(prefix string, err error) {
+	c.Logger().Warn(prefix, "error", err)
+	e := musicError(err)
+	msg := prefix + "，" + e.msg
+	if c.IsWebSocket() {
+		c.conn.Send(base.H{
+			"type": "info/push",
+			"info": msg,
+			"code": e.code,
+		})
+	}
+	if c.IsHTTP() {
+		writeJSON(c.hw, e.status, base.H{"error": msg, "code": e.code})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/auth"
+	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/music"
+	"github.com/bihua-university/alisten/internal/storage"
+)
+
+// maxHistorySize 每个房间保留的播放历史条数
+const maxHistorySize = 200
+
+// EndReason 歌曲结束播放的原因
+type EndReason int
+
+const (
+	Finished     EndReason = iota // 播放完毕
+	VoteSkipped                   // 投票切歌
+	ForceSkipped                  // 房管切歌
+)
+
+func (r EndReason) String() string {
+	switch r {
+	case Finished:
+		return "finished"
+	case VoteSkipped:
+		return "vote_skipped"
+	case ForceSkipped:
+		return "force_skipped"
+	default:
+		return "unknown"
+	}
+}
+
+// History 一条播放历史
+type History struct {
+	Order
+	Start  time.Time
+	Reason EndReason
+}
+
+// recordHistory 将当前歌曲加入播放历史，调用方需持有 h.Mu
+func (h *House) recordHistory(reason EndReason) {
+	if h.Current.id == "" {
+		return
+	}
+	if !h.End.After(time.Now()) {
+		// 歌曲已经播放完毕，之后才有新歌可以切换
+		reason = Finished
+	}
+	h.History = append(h.History, History{
+		Order:  h.Current,
+		Start:  time.UnixMilli(h.PushTime),
+		Reason: reason,
+	})
+	if len(h.History) > maxHistorySize {
+		h.History = h.History[len(h.History)-maxHistorySize:]
+	}
+}
+
+func toStorageHistory(list []History) []storage.History {
+	r := make([]storage.History, 0, len(list))
+	for _, v := range list {
+		r = append(r, storage.History{
+			Order:  toStorageOrder(v.Order),
+			Start:  v.Start.UnixMilli(),
+			Reason: int(v.Reason),
+		})
+	}
+	return r
+}
+
+func fromStorageHistory(list []storage.History) []History {
+	r := make([]History, 0, len(list))
+	for _, v := range list {
+		r = append(r, History{
+			Order:  fromStorageOrder(v.Order),
+			Start:  time.UnixMilli(v.Start),
+			Reason: EndReason(v.Reason),
+		})
+	}
+	return r
+}
+
+// historyItem 播放历史接口返回的条目
+type historyItem struct {
+	Source    string    `json:"source"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Artist    string    `json:"artist"`
+	Album     string    `json:"album"`
+	Duration  int64     `json:"duration"`
+	Cover     string    `json:"pictureUrl"`
+	User      auth.User `json:"user"`
+	Likes     int       `json:"likes"`
+	StartTime int64     `json:"startTime"`
+	EndReason string    `json:"endReason"`
+}
+
+// getHistory 分页返回播放历史，最近播放的在前
+func getHistory(c *Context) {
+	page := max(c.Get("pageIndex").Int(), 1)
+	pageSize := c.Get("pageSize").Int()
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+
+	var list []History
+	var total int64
+	c.WithHouse(func(h *House) {
+		total = int64(len(h.History))
+		// 倒序分页
+		end := total - (page-1)*pageSize
+		start := max(end-pageSize, 0)
+		for i := end - 1; i >= start; i-- {
+			list = append(list, h.History[i])
+		}
+	})
+
+	data := make([]historyItem, 0, len(list))
+	for _, v := range list {
+		item := historyItem{
+			Source:    v.source,
+			ID:        v.id,
+			User:      v.user,
+			Likes:     v.likes,
+			StartTime: v.Start.UnixMilli(),
+			EndReason: v.Reason.String(),
+		}
+		if t, err := music.GetMusic(v.source, v.id, true); err == nil {
+			item.Name, item.Artist, item.Album = t.Name, t.Artist, t.Album
+			item.Duration, item.Cover = t.Duration, t.PictureURL
+		}
+		data = append(data, item)
+	}
+
+	if c.IsWebSocket() {
+		c.conn.Send(base.H{
+			"type":      "music/history",
+			"data":      data,
+			"totalSize": total,
+		})
+	}
+	if c.IsHTTP() {
+		c.Send(base.H{
+			"list":      data,
+			"totalSize": total,
+		})
+	}
+}
+
+// pickHistory 重新点播放历史中的歌曲
+func pickHistory(c *Context) {
+	source := c.Get("source").String()
+	id := c.Get("id").String()
+
+	found := false
+	c.WithHouse(func(h *House) {
+		for _, v := range h.History {
+			if v.source == source && v.id == id {
+				found = true
+				return
+			}
+		}
+	})
+	if !found {
+		c.Fail(http.StatusNotFound, "播放历史中没有这首歌")
+		return
+	}
+
+	if !checkPick(c) {
+		return
+	}
+	respondPick(c, doPickMusic(c.house, id, "", source, c.User(), c.GuestID()))
+}
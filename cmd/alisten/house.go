@@ -1,8 +1,8 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
+	"log/slog"
 	"math/rand/v2"
 	"net/http"
 	"sync"
@@ -10,7 +10,9 @@ import (
 
 	"github.com/bihua-university/alisten/internal/auth"
 	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/metrics"
 	"github.com/bihua-university/alisten/internal/music"
+	"github.com/bihua-university/alisten/internal/storage"
 	"github.com/bihua-university/alisten/internal/syncx"
 
 	"github.com/google/uuid"
@@ -22,6 +24,7 @@ type Mode int
 const (
 	NormalMode Mode = iota
 	RandomMode
+	FairMode // 轮流播放每个用户点的歌
 )
 
 func (m Mode) String() string {
@@ -30,6 +33,8 @@ func (m Mode) String() string {
 		return "sequential"
 	case RandomMode:
 		return "random"
+	case FairMode:
+		return "fair"
 	default:
 		return "unknown"
 	}
@@ -37,15 +42,21 @@ func (m Mode) String() string {
 
 type House struct {
 	Mu         sync.Mutex
+	ID         string
 	Name       string
 	Desc       string
 	Password   string
+	Owner      string   // 房主的账号 ID，为空表示没有房主
+	Moderators []string // 房管的账号 ID
+	Bans       []Restriction
+	Mutes      []Restriction
+	History    []History // 播放历史，按播放顺序
 	Mode       Mode
 	Current    Order
 	End        time.Time
 	PushTime   int64
 	Playlist   []Order
-	VoteSkip   []auth.User
+	VoteSkip   []string // 已投票切歌的用户，见 userKey
 	Connection []*Connection
 
 	// private
@@ -53,13 +64,23 @@ type House struct {
 	lastActiveTime time.Time
 	queue          syncx.UnboundedChan[[]byte]
 	close          chan struct{}
+	closeMu        sync.RWMutex // 保护 closed，避免向已关闭的 queue 广播
+	closed         bool
 	lastOrderTime  time.Time
+	orderSeq       uint64 // 最后一次点歌的序号
 	recommander    *music.NeteaseMusicRecommander
+	lastServed     map[string]time.Time // 用户上次有歌曲开始播放的时间
+
+	// storage
+	saveMu    sync.Mutex
+	forgotten bool
 
 	// limiters
+	limits        base.Limits
 	searchLimiter *rate.Limiter
 	orderLimiter  *rate.Limiter
 	likeLimiter   *rate.Limiter
+	userLimiters  map[string]*rate.Limiter // 每个用户的点歌频率
 }
 
 var housesMu sync.Mutex
@@ -71,6 +92,7 @@ func addHouseHTTP(w http.ResponseWriter, r *http.Request) {
 		Desc     string `json:"desc"`
 		NeedPwd  bool   `json:"needPwd"`
 		Password string `json:"password"`
+		Token    string `json:"token"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
@@ -78,38 +100,60 @@ func addHouseHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 登录用户创建的房间以其为房主，登录令牌与其他 HTTP 接口一样可以放在请求头或请求体中
+	token := sessionToken(r)
+	if token == "" {
+		token = requestBody.Token
+	}
+	owner, err := resolveUser(r, token)
+	if err != nil {
+		writeAccountError(w, err)
+		return
+	}
+	var ownerID string
+	if owner != nil {
+		ownerID = owner.ID
+	}
+
+	if shuttingDown.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, base.H{"error": "服务器正在重启"})
+		return
+	}
+
 	houseID := uuid.New().String()
-	createHouse(houseID, requestBody.Name, requestBody.Desc, requestBody.Password, false)
+	createHouse(houseID, requestBody.Name, requestBody.Desc, requestBody.Password, ownerID, false, nil)
 	writeJSON(w, http.StatusOK, base.H{"houseId": houseID})
 }
 
-func createHouse(houseID string, name, desc, password string, persist bool) {
+// createHouse 创建并启动房间，state 不为空时从中恢复播放状态
+func createHouse(houseID string, name, desc, password, owner string, persist bool, state *storage.House) {
 	house := &House{
+		ID:       houseID,
 		Name:     name,
 		Desc:     desc,
 		Password: password,
+		Owner:    owner,
 		Mode:     NormalMode,
 		Playlist: make([]Order, 0),
-		VoteSkip: make([]auth.User, 0),
+		VoteSkip: make([]string, 0),
 
 		ultimate:       persist,
 		lastActiveTime: time.Now(),
 		queue:          syncx.NewUnboundedChan[[]byte](8),
 		close:          make(chan struct{}),
 		recommander:    music.NewNeteaseMusicRecommander(),
+		lastServed:     make(map[string]time.Time),
+		userLimiters:   make(map[string]*rate.Limiter),
 	}
-	if !house.ultimate {
-		house.searchLimiter = rate.NewLimiter(rate.Every(time.Minute), 10)
-		house.orderLimiter = rate.NewLimiter(rate.Every(time.Minute), 5)
-		house.likeLimiter = rate.NewLimiter(rate.Every(time.Minute), 5)
-	} else {
-		house.orderLimiter = rate.NewLimiter(rate.Every(time.Minute), 30)
-		house.likeLimiter = rate.NewLimiter(rate.Every(time.Minute), 30)
+	if state != nil {
+		house.restore(state)
 	}
+	house.applyLimits()
 	housesMu.Lock()
 	houses[houseID] = house
 	housesMu.Unlock()
 
+	house.save()
 	house.Start()
 }
 
@@ -130,13 +174,13 @@ func enterHouseHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	house, exists := houses[request.HouseID]
-	if !exists {
+	house := GetHouse(request.HouseID)
+	if house == nil {
 		writeJSON(w, http.StatusNotFound, base.H{"error": "房间不存在"})
 		return
 	}
 
-	if house.Password != request.Password {
+	if !house.CheckPassword(request.Password) {
 		writeJSON(w, http.StatusUnauthorized, base.H{"error": "密码错误"})
 		return
 	}
@@ -170,6 +214,15 @@ func (h *House) lock(fn func()) {
 	fn()
 }
 
+// CheckPassword 检查房间密码，密码可能被房主或管理员修改，需要持有 h.Mu 读取
+func (h *House) CheckPassword(password string) bool {
+	var ok bool
+	h.lock(func() {
+		ok = h.Password == password
+	})
+	return ok
+}
+
 func (h *House) Start() {
 	ticker := time.NewTicker(time.Millisecond * 500)
 	go func() {
@@ -178,7 +231,12 @@ func (h *House) Start() {
 			case <-h.close:
 				ticker.Stop()
 				return
-			case j := <-h.queue.Out():
+			case j, ok := <-h.queue.Out():
+				if !ok {
+					// 房间已关闭
+					ticker.Stop()
+					return
+				}
 				h.lock(func() {
 					for _, conn := range h.Connection {
 						conn.SendRaw(j)
@@ -193,7 +251,11 @@ func (h *House) Start() {
 
 func (h *House) Broadcast(msg any) {
 	j := encJson(msg)
-	h.queue.In() <- j
+	h.closeMu.RLock()
+	defer h.closeMu.RUnlock()
+	if !h.closed {
+		h.queue.In() <- j
+	}
 }
 
 func (h *House) Update() {
@@ -204,47 +266,49 @@ func (h *House) Update() {
 			skip = true
 		}
 		// 检查是否需要清理房间
-		if len(h.Connection) == 0 && !h.ultimate && time.Since(h.lastActiveTime) > 5*time.Minute {
+		if h.idleExpired() {
 			h.closeHouse()
 		}
 	})
 
 	if skip {
-		h.Skip(false) // 切歌
+		h.Skip(Finished) // 切歌
 	}
 }
 
 func (h *House) Push(o Order) {
-	m := music.GetMusic(o.source, o.id, false)
-	duration, ok := m["duration"].(int64)
-	if !ok {
+	t, err := music.GetMusic(o.source, o.id, false)
+	if err != nil {
+		slog.Warn("play music failed", base.LogHouse, h.ID, base.LogSource, o.source, "id", o.id, "error", err)
+		e := musicError(err)
+		h.Broadcast(base.H{
+			"type": "info/push",
+			"info": "无法播放，" + e.msg,
+			"code": e.code,
+		})
 		return
 	}
 
-	var r base.H
+	var r *currentMusic
 	h.lock(func() {
 		now := time.Now()
 		h.PushTime = now.Add(200 * time.Millisecond).UnixMilli() // 200ms delay
-		h.End = now.Add(time.Duration(duration) * time.Millisecond)
-		r = merge(m, base.H{
-			"pushTime": h.PushTime,
-		})
+		h.End = now.Add(time.Duration(t.Duration) * time.Millisecond)
+		r = newCurrentMusic(t, h.PushTime)
 	})
 
 	h.Broadcast(r)
 }
 
 func (h *House) enter(c *Connection) {
-	var list []base.H
+	var list []playlistItem
 	var u []auth.User
 	h.lock(func() {
 		if h.Current.id != "" {
 			// 发送播放单曲
-			m := music.GetMusic(h.Current.source, h.Current.id, false)
-			r := merge(m, base.H{
-				"pushTime": h.PushTime,
-			})
-			c.Send(r)
+			if t, err := music.GetMusic(h.Current.source, h.Current.id, false); err == nil {
+				c.Send(newCurrentMusic(t, h.PushTime))
+			}
 		}
 		list = h.playlist()
 		for _, conn := range h.Connection {
@@ -262,24 +326,19 @@ func (h *House) enter(c *Connection) {
 	})
 }
 
-func (h *House) playlist() []base.H {
-	var list []base.H
+func (h *House) playlist() []playlistItem {
+	var list []playlistItem
 
-	// playlist don't need this information
 	push := func(o Order) {
-		if o.id == "" {
+		if o.status != orderReady {
+			list = append(list, o.item())
 			return
 		}
-		m := music.GetMusic(o.source, o.id, true)
-		keep := []string{"type", "source", "artist", "duration", "name", "album", "pictureUrl", "webUrl"}
-		r := make(base.H, len(keep)+1)
-		for _, k := range keep {
-			if v, ok := m[k]; ok {
-				r[k] = v
-			}
+		if o.id == "" {
+			return
 		}
-		r["user"] = o.user
-		list = append(list, r)
+		t, _ := music.GetMusic(o.source, o.id, true)
+		list = append(list, newPlaylistItem(t, o.user))
 	}
 
 	push(h.Current)
@@ -301,7 +360,9 @@ func (h *House) PushPlaylist() {
 	})
 }
 
-func (h *House) Skip(force bool) {
+// Skip 切换到下一首歌，reason 为当前歌曲结束的原因，Finished 以外的原因会跳过正在播放的歌曲
+func (h *House) Skip(reason EndReason) {
+	force := reason != Finished
 	var play Order
 	change := false
 	h.lock(func() {
@@ -311,20 +372,27 @@ func (h *House) Skip(force bool) {
 		if !force && h.Current.id != "" && h.End.After(time.Now()) {
 			return
 		}
-		if len(h.Playlist) == 0 {
+		// 跳过正在获取或获取失败的点歌
+		var ready []int
+		for i, o := range h.Playlist {
+			if o.status == orderReady {
+				ready = append(ready, i)
+			}
+		}
+		if len(ready) == 0 {
 			return
 		}
+		h.recordHistory(reason)
+		choose := ready[0]
 		switch h.Mode {
-		case NormalMode:
-			h.Current = h.Playlist[0]
-			h.Playlist = h.Playlist[1:]
 		case RandomMode:
-			choose := rand.IntN(len(h.Playlist))
-			h.Current = h.Playlist[choose]
-			h.Playlist = append(h.Playlist[:choose], h.Playlist[choose+1:]...)
-		default:
-			// nothing
+			choose = ready[rand.IntN(len(ready))]
+		case FairMode:
+			choose = h.nextFair()
 		}
+		h.Current = h.Playlist[choose]
+		h.Playlist = append(h.Playlist[:choose], h.Playlist[choose+1:]...)
+		h.markServed(h.Current)
 		play = h.Current
 		h.VoteSkip = nil
 		change = true
@@ -351,6 +419,7 @@ func (h *House) Skip(force bool) {
 			choose := rand.IntN(len(list))
 			h.Playlist = append(h.Playlist, Order{source: "wy", id: list[choose], user: auth.User{Name: "系统推荐"}})
 		})
+		h.save()
 		h.PushPlaylist()
 	}
 }
@@ -375,7 +444,7 @@ func (h *House) Leave(c *Connection) {
 		}
 
 		// free
-		close(c.send.In())
+		c.closeSend()
 	})
 	// 广播更新后的用户列表
 	h.Broadcast(base.H{
@@ -405,30 +474,63 @@ func houseuser(c *Context) {
 }
 
 func settingSync(c *Context) {
-	c.conn.mu.Lock()
-	defer c.conn.mu.Unlock()
+	user := c.User()
+	var data base.H
+	c.WithHouse(func(h *House) {
+		data = h.settings(user)
+	})
 
 	c.conn.Send(base.H{
 		"type": "setting/push",
-		"data": base.H{
-			"playmode": c.house.Mode.String(),
-		},
+		"data": data,
+	})
+}
+
+// settings 返回用户看到的房间设置，调用方需持有 h.Mu
+func (h *House) settings(u auth.User) base.H {
+	return base.H{
+		"playmode":   h.Mode.String(),
+		"role":       h.roleOf(u).String(),
+		"owner":      h.Owner,
+		"moderators": h.Moderators,
+		"limits":     h.effectiveLimits(),
+	}
+}
+
+// pushSettings 向房间内所有连接推送各自的房间设置
+func (h *House) pushSettings() {
+	h.lock(func() {
+		for _, conn := range h.Connection {
+			conn.Send(base.H{
+				"type": "setting/push",
+				"data": h.settings(conn.GetUser()),
+			})
+		}
 	})
 }
 
-// 关闭当前房间
+// 关闭当前房间并从存储中删除
 func (h *House) closeHouse() {
-	// 查找当前房间的ID
+	if h.stop() {
+		go h.forget()
+	}
+}
+
+// stop 停止房间并从房间列表中移除，不删除已保存的状态，房间已关闭时返回 false
+func (h *House) stop() bool {
 	housesMu.Lock()
-	for id, house := range houses {
-		if house == h {
-			close(h.queue.In())
-			close(h.close)
-			delete(houses, id)
-			break
-		}
+	defer housesMu.Unlock()
+	if houses[h.ID] != h {
+		return false
 	}
-	housesMu.Unlock()
+	delete(houses, h.ID)
+
+	h.closeMu.Lock()
+	h.closed = true
+	close(h.queue.In())
+	h.closeMu.Unlock()
+	close(h.close)
+	return true
 }
 
 const (
@@ -438,16 +540,26 @@ const (
 )
 
 func (h *House) Wait(t uint8) bool {
-	if t&WaitSearch != 0 && h.searchLimiter != nil {
-		h.searchLimiter.Wait(context.Background())
+	var search, order, like *rate.Limiter
+	h.lock(func() {
+		search, order, like = h.searchLimiter, h.orderLimiter, h.likeLimiter
+	})
+	if t&WaitSearch != 0 && search != nil {
+		// 搜索不拒绝，只排队等待
+		if d := search.Reserve().Delay(); d > 0 {
+			metrics.RateLimited.WithLabelValues("search").Inc()
+			time.Sleep(d)
+		}
 	}
-	if t&WaitOrder != 0 && h.orderLimiter != nil {
-		if !h.orderLimiter.Allow() {
+	if t&WaitOrder != 0 && order != nil {
+		if !order.Allow() {
+			metrics.RateLimited.WithLabelValues("order").Inc()
 			return false
 		}
 	}
-	if t&WaitLike != 0 && h.likeLimiter != nil {
-		if !h.likeLimiter.Allow() {
+	if t&WaitLike != 0 && like != nil {
+		if !like.Allow() {
+			metrics.RateLimited.WithLabelValues("like").Inc()
 			return false
 		}
 	}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/base"
+
+	"golang.org/x/time/rate"
+)
+
+// 内置的房间限制，可以通过配置文件的 limits.normal 和 limits.ultimate 覆盖
+var (
+	builtinNormalLimits = base.Limits{
+		Search:      10,
+		Order:       5,
+		Like:        5,
+		Queue:       10,
+		IdleTimeout: 300,
+		VoteSkip:    1.0 / 3,
+		UserQueue:   3,
+		UserOrder:   3,
+	}
+	builtinUltimateLimits = base.Limits{
+		Search:      -1,
+		Order:       30,
+		Like:        30,
+		Queue:       -1,
+		IdleTimeout: -1,
+		VoteSkip:    1.0 / 3,
+		UserQueue:   10,
+		UserOrder:   3,
+	}
+)
+
+// defaultLimits 返回房间默认的限制
+func defaultLimits(ultimate bool) base.Limits {
+	c := base.Current()
+	if ultimate {
+		return c.UltimateLimits.Merge(builtinUltimateLimits)
+	}
+	return c.NormalLimits.Merge(builtinNormalLimits)
+}
+
+// effectiveLimits 返回房间实际生效的限制，调用方需持有 h.Mu
+func (h *House) effectiveLimits() base.Limits {
+	return h.limits.Merge(defaultLimits(h.ultimate))
+}
+
+// applyLimits 根据房间的频率限制重建限流器，调用方需持有 h.Mu 或在房间启动前调用
+func (h *House) applyLimits() {
+	l := h.effectiveLimits()
+	h.searchLimiter = newLimiter(l.Search)
+	h.orderLimiter = newLimiter(l.Order)
+	h.likeLimiter = newLimiter(l.Like)
+	// 每个用户的限流器按新的频率重新创建
+	clear(h.userLimiters)
+}
+
+// newLimiter 创建每分钟最多 n 次的限流器，n 小于等于 0 时不限制
+func newLimiter(n int) *rate.Limiter {
+	if n <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Every(time.Minute), n)
+}
+
+// queueFull 播放列表是否已达到上限，调用方需持有 h.Mu
+func (h *House) queueFull() (bool, int) {
+	n := h.effectiveLimits().Queue
+	return n > 0 && len(h.Playlist) >= n, n
+}
+
+// idleExpired 房间无人的时间是否超过了自动关闭的时间，调用方需持有 h.Mu
+func (h *House) idleExpired() bool {
+	timeout := h.effectiveLimits().IdleTimeout
+	return len(h.Connection) == 0 && timeout > 0 &&
+		time.Since(h.lastActiveTime) > time.Duration(timeout)*time.Second
+}
+
+// requiredVotes 投票切歌需要的票数，至少为 1，调用方需持有 h.Mu
+//
+// 按在线用户计算，同一账号的多个连接只算一人，与投票去重的方式一致。
+func (h *House) requiredVotes() int {
+	ratio := h.effectiveLimits().VoteSkip
+	voters := make(map[string]struct{}, len(h.Connection))
+	for _, conn := range h.Connection {
+		voters[userKey(conn.GetUser(), conn.guest)] = struct{}{}
+	}
+	return max(int(math.Ceil(float64(len(voters))*ratio)), 1)
+}
+
+// reapplyLimits 配置中的默认值修改后重建所有房间的限流器
+func reapplyLimits() {
+	for _, h := range allHouses() {
+		h.lock(h.applyLimits)
+	}
+}
+
+// houseSettings 房主修改房间限制，未传的字段保持不变，传 0 恢复默认值
+//
+// 房主不能取消频率限制，负数只能通过配置文件或管理接口设置。
+func houseSettings(c *Context) {
+	if !c.Require(OwnerRole) {
+		return
+	}
+
+	var l base.Limits
+	c.WithHouse(func(h *House) {
+		l = h.limits
+	})
+	fields := []struct {
+		key string
+		val *int
+	}{
+		{"search", &l.Search},
+		{"order", &l.Order},
+		{"like", &l.Like},
+		{"queue", &l.Queue},
+		{"idleTimeout", &l.IdleTimeout},
+		{"userQueue", &l.UserQueue},
+		{"userOrder", &l.UserOrder},
+	}
+	for _, f := range fields {
+		if v := c.Get(f.key); v.Exists() {
+			if v.Int() < 0 {
+				c.Fail(http.StatusBadRequest, "限制不能为负数")
+				return
+			}
+			*f.val = int(v.Int())
+		}
+	}
+	if v := c.Get("voteSkip"); v.Exists() {
+		l.VoteSkip = v.Float()
+	}
+	if err := l.Validate(); err != nil {
+		c.Fail(http.StatusBadRequest, "投票切歌比例需要在 0 到 1 之间")
+		return
+	}
+
+	c.WithHouse(func(h *House) {
+		h.limits = l
+		h.applyLimits()
+	})
+	c.house.save()
+	c.house.pushSettings()
+	if c.IsWebSocket() {
+		c.Info("房间设置已更新")
+	}
+	if c.IsHTTP() {
+		var data base.H
+		c.WithHouse(func(h *House) {
+			data = h.settings(c.User())
+		})
+		c.Send(data)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/music"
+	"github.com/bihua-university/alisten/internal/music/local"
+)
+
+// signingKey 返回用途为 purpose 的签名密钥，由 auth.secret 派生
+func signingKey(purpose string) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(purpose))
+	return m.Sum(nil)
+}
+
+// applyLocalLibrary 按配置启用或更新本地曲库，目录和地址不变时只重新扫描
+func applyLocalLibrary(c base.Configuration) {
+	if c.LocalDir == "" {
+		music.SetLocalLibrary(nil)
+		return
+	}
+	lib := music.LocalLibrary()
+	if lib == nil || lib.Dir() != c.LocalDir || lib.BaseURL() != c.PublicURL {
+		lib = local.New(c.LocalDir, signingKey("local"), c.PublicURL)
+	}
+
+	// 扫描较大的曲库需要一段时间，扫描完成后再启用
+	go func() {
+		start := time.Now()
+		if err := lib.Scan(); err != nil {
+			slog.Error("scan local music", "error", err)
+			return
+		}
+		music.SetLocalLibrary(lib)
+		slog.Info("local music scanned", "dir", lib.Dir(), "tracks", lib.Len(), "duration", time.Since(start))
+	}()
+}
+
+// localStreamHTTP 本地音乐的播放地址
+func localStreamHTTP(w http.ResponseWriter, r *http.Request) {
+	lib := music.LocalLibrary()
+	if lib == nil {
+		http.NotFound(w, r)
+		return
+	}
+	lib.ServeStream(w, r)
+}
+
+// localCoverHTTP 本地音乐的封面地址
+func localCoverHTTP(w http.ResponseWriter, r *http.Request) {
+	lib := music.LocalLibrary()
+	if lib == nil {
+		http.NotFound(w, r)
+		return
+	}
+	lib.ServeCover(w, r)
+}
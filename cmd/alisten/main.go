@@ -2,23 +2,32 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"runtime/debug"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/bihua-university/alisten/internal/auth"
 	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/metrics"
+	"github.com/bihua-university/alisten/internal/music/local"
+	"github.com/bihua-university/alisten/internal/music/upload"
 	"github.com/bihua-university/alisten/internal/syncx"
 	"github.com/bihua-university/alisten/internal/task"
 
-	"github.com/caddyserver/certmagic"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/tidwall/gjson"
 )
 
@@ -27,9 +36,24 @@ var upgrader = websocket.Upgrader{
 } // use default options
 
 func main() {
-	base.InitConfig()
+	configPath := flag.String("config", "", "配置文件路径，默认为工作目录下的 config.json")
+	flag.Parse()
+
+	if err := base.InitConfig(*configPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	base.InitLogger()
+	openStore()
+	initAccounts()
+	applyLocalLibrary(base.Config)
+	applyUploadLibrary(base.Config)
+	go collectUploads()
 
 	task.Scheduler = task.NewServer(base.Config.Token) // 可以从配置文件读取token
+	task.Scheduler.SetRetryPolicies(retryPolicies(base.Config))
+	// 本地文件只有启用了本地文件处理器的 Go musiclet 可以执行
+	task.Scheduler.RequireDeclared("local:get_music")
 
 	// 创建HTTP multiplexer
 	mux := http.NewServeMux()
@@ -38,6 +62,10 @@ func main() {
 	handler := logMiddleware(mux)
 	handler = corsMiddleware(handler)
 
+	// 账号相关路由
+	mux.HandleFunc("POST /auth/register", registerHTTP)
+	mux.HandleFunc("POST /auth/login", loginHTTP)
+
 	// 房间相关路由
 	mux.HandleFunc("/house/add", addHouseHTTP)
 	mux.HandleFunc("/house/enter", enterHouseHTTP)
@@ -52,36 +80,90 @@ func main() {
 	mux.HandleFunc("POST /music/search", wrapWebsocket(searchMusic))
 	mux.HandleFunc("POST /music/searchsonglist", wrapWebsocket(searchList))
 	mux.HandleFunc("POST /music/playmode", wrapWebsocket(playMode))
+	mux.HandleFunc("POST /music/skip/force", wrapWebsocket(forceSkip))
+	mux.HandleFunc("POST /music/clear", wrapWebsocket(clearMusic))
+	mux.HandleFunc("POST /music/history", wrapWebsocket(getHistory))
+	mux.HandleFunc("POST /music/history/pick", wrapWebsocket(pickHistory))
+	mux.HandleFunc("GET "+local.StreamPath, localStreamHTTP)
+	mux.HandleFunc("GET "+local.CoverPath, localCoverHTTP)
+	mux.HandleFunc("POST /music/upload", uploadMusicHTTP)
+	mux.HandleFunc("GET "+upload.StreamPath, uploadStreamHTTP)
+	mux.HandleFunc("GET "+upload.CoverPath, uploadCoverHTTP)
+	mux.HandleFunc("POST /house/edit", wrapWebsocket(editHouse))
+	mux.HandleFunc("POST /setting/house", wrapWebsocket(houseSettings))
+	mux.HandleFunc("POST /house/moderator/add", wrapWebsocket(addModerator))
+	mux.HandleFunc("POST /house/moderator/remove", wrapWebsocket(removeModerator))
+	mux.HandleFunc("POST /house/kick", wrapWebsocket(kickUser))
+	mux.HandleFunc("POST /house/ban", wrapWebsocket(banUser))
+	mux.HandleFunc("POST /house/unban", wrapWebsocket(unbanUser))
+	mux.HandleFunc("POST /house/mute", wrapWebsocket(muteUser))
+	mux.HandleFunc("POST /house/unmute", wrapWebsocket(unmuteUser))
+	mux.HandleFunc("POST /house/restriction", wrapWebsocket(restrictionList))
 
 	// task long-polling
 	mux.HandleFunc("GET /tasks/poll", task.Scheduler.PollTaskHandler)
 	mux.HandleFunc("POST /tasks/result", task.Scheduler.SubmitResultHandler)
+	mux.HandleFunc("POST /tasks/heartbeat", task.Scheduler.HeartbeatHandler)
+	mux.HandleFunc("POST /tasks/progress", task.Scheduler.ProgressHandler)
+	mux.HandleFunc("GET /tasks/ws", task.Scheduler.StreamHandler)
+	mux.Handle("GET /tasks/workers", adminOnly(http.HandlerFunc(task.Scheduler.WorkersHandler)))
+	mux.Handle("GET /tasks/queue", adminOnly(http.HandlerFunc(task.Scheduler.QueueHandler)))
+
+	// 管理接口
+	registerAdmin(mux)
+
+	// 监控指标
+	mux.Handle("GET /metrics", adminOnly(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})))
 
 	mux.HandleFunc("/server", func(w http.ResponseWriter, r *http.Request) {
 		houseId := r.URL.Query().Get("houseId")
 		password := r.URL.Query().Get("housePwd")
 
+		if shuttingDown.Load() {
+			writeJSON(w, http.StatusServiceUnavailable, base.H{"error": "服务器正在重启"})
+			return
+		}
 		house := GetHouse(houseId)
-		if house == nil || house.Password != password {
+		if house == nil || !house.CheckPassword(password) {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
 
+		// 浏览器无法为 WebSocket 设置请求头，登录令牌也可以通过 query 传递
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			token = sessionToken(r)
+		}
+		account, err := resolveUser(r, token)
+		if err != nil {
+			writeAccountError(w, err)
+			return
+		}
+
+		ip := maskIP(r.RemoteAddr)
+		user := auth.User{Name: guestName("", ip)}
+		if account != nil {
+			user = *account
+		}
+		if house.Banned(user, ip) {
+			writeJSON(w, http.StatusForbidden, base.H{"error": "你已被禁止进入该房间"})
+			return
+		}
+
 		wc, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
-			log.Print("upgrade:", err)
+			slog.Warn("websocket upgrade", base.LogHouse, houseId, "error", err)
 			return
 		}
 		defer wc.Close()
 
-		ip := maskIP(r.RemoteAddr)
 		conn := &Connection{
-			conn: wc,
-			ip:   ip,
-			user: auth.User{
-				Name: "游客(" + ip + ")",
-			},
-			send: syncx.NewUnboundedChan[[]byte](8),
+			id:    newConnectionID(),
+			conn:  wc,
+			ip:    ip,
+			guest: "conn:" + uuid.NewString(),
+			user:  user,
+			send:  syncx.NewUnboundedChan[[]byte](8),
 		}
 
 		house.Mu.Lock()
@@ -91,11 +173,12 @@ func main() {
 
 		conn.Start()
 		house.enter(conn)
+		slog.Info("connection opened", base.LogHouse, house.ID, base.LogConn, conn.id, base.LogUser, user.Name)
 
 		for {
 			_, message, err := wc.ReadMessage()
 			if err != nil {
-				log.Println("read:", err)
+				slog.Info("connection closed", base.LogHouse, house.ID, base.LogConn, conn.id, "reason", err)
 				// remove from connections and broadcast updated user list
 				house.Leave(conn)
 				break
@@ -106,64 +189,78 @@ func main() {
 				defer func() {
 					// prevent crash
 					if err := recover(); err != nil {
-						log.Println(err, "\n", string(debug.Stack()))
+						slog.Error("panic", base.LogHouse, house.ID, base.LogConn, conn.id, "error", err, "stack", string(debug.Stack()))
 					}
 				}()
 
 				msg := gjson.ParseBytes(message)
-				handler := route[msg.Get("action").String()]
-
-				if base.Config.Debug {
-					fmt.Println("cmd:", msg.Get("action").String(), "data:", msg.Get("data").String())
+				action := msg.Get("action").String()
+				handler := route[action]
+
+				c := &Context{
+					conn:   conn,
+					house:  house,
+					action: action,
+					data:   msg.Get("data"),
 				}
-
-				if handler != nil {
-					c := &Context{
-						conn:  conn,
-						house: house,
-						data:  msg.Get("data"),
-					}
-					handler(c)
-				} else {
-					log.Printf("unhandled message: %s", message)
+				if handler == nil {
+					c.Logger().Warn("unhandled message", "message", string(message))
+					return
 				}
+				c.Logger().Debug("command", "data", c.data.String())
+				handler(c)
 			}()
 		}
 	})
 
-	// 创建持久化房间
-	for _, house := range base.Config.Persist {
-		createHouse(house.ID, house.Name, house.Desc, house.Password, true)
-	}
+	// 创建持久化房间并恢复已保存的房间
+	initHouses()
+	watchConfig()
 
-	if base.Config.Debug {
-		log.Fatal(http.ListenAndServe(":8080", handler))
-	} else {
-		certmagic.HTTPS([]string{base.Config.Addr}, handler)
+	// 收到 SIGTERM 或 SIGINT 后优雅关闭
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	if err := serve(ctx, handler); err != nil {
+		slog.Error("serve", "error", err)
+		os.Exit(1)
 	}
 }
 
 var route = map[string]func(ctx *Context){
-	"/chat":                 chat,
-	"/setting/user":         setUser,
-	"/setting/pull":         settingSync,
-	"/music/search":         searchMusic,
-	"/music/pick":           pickMusic,
-	"/music/delete":         deleteMusic,
-	"/music/good":           goodMusic,
-	"/music/skip/vote":      voteSkip,
-	"/music/searchsonglist": searchList,
-	"/music/playmode":       playMode,
-	"/music/sync":           getCurrentMusic,
-	"/music/recommend":      recommendMusic,
-	"/house/houseuser":      houseuser,
+	"/chat":                   chat,
+	"/setting/user":           setUser,
+	"/setting/pull":           settingSync,
+	"/setting/house":          houseSettings,
+	"/music/search":           searchMusic,
+	"/music/pick":             pickMusic,
+	"/music/delete":           deleteMusic,
+	"/music/good":             goodMusic,
+	"/music/skip/vote":        voteSkip,
+	"/music/searchsonglist":   searchList,
+	"/music/playmode":         playMode,
+	"/music/sync":             getCurrentMusic,
+	"/music/recommend":        recommendMusic,
+	"/music/skip/force":       forceSkip,
+	"/music/clear":            clearMusic,
+	"/music/history":          getHistory,
+	"/music/history/pick":     pickHistory,
+	"/house/houseuser":        houseuser,
+	"/house/edit":             editHouse,
+	"/house/moderator/add":    addModerator,
+	"/house/moderator/remove": removeModerator,
+	"/house/kick":             kickUser,
+	"/house/ban":              banUser,
+	"/house/unban":            unbanUser,
+	"/house/mute":             muteUser,
+	"/house/unmute":           unmuteUser,
+	"/house/restriction":      restrictionList,
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "token,content-type,accesstoken")
+		w.Header().Set("Access-Control-Allow-Headers", "token,content-type,accesstoken,authorization")
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -186,8 +283,7 @@ func (l *logResponseWriter) Write(b []byte) (int, error) {
 }
 
 func (l *logResponseWriter) WriteHeader(statusCode int) {
-	t := time.Now().Format(time.DateTime)
-	fmt.Printf("[%s] %s \"%s %s\" %d\n", t, l.r.RemoteAddr, l.r.Method, l.r.URL.Path, statusCode)
+	slog.Info("http", "remote", l.r.RemoteAddr, "method", l.r.Method, "path", l.r.URL.Path, "status", statusCode)
 	l.w.WriteHeader(statusCode)
 }
 
@@ -214,6 +310,14 @@ func maskIP(ip string) string {
 	return ip + ".*.*"
 }
 
+// remoteHost 返回请求地址中的 IP，去掉端口
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
 func lastCut(s, sep string) string {
 	if i := strings.LastIndex(s, sep); i >= 0 {
 		return s[:i]
@@ -231,23 +335,51 @@ func wrapWebsocket(fn func(*Context)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, _ := io.ReadAll(r.Body)
 		defer r.Body.Close()
-		msg := gjson.ParseBytes(body)
-
-		house := GetHouse(msg.Get("houseId").String())
-		if house == nil {
-			writeJSON(w, http.StatusNotFound, base.H{"error": "房间不存在"})
-			return
-		}
-		if house.Password != msg.Get("password").String() {
-			writeJSON(w, http.StatusUnauthorized, base.H{"error": "密码错误"})
-			return
+		if c := newHTTPContext(w, r, gjson.ParseBytes(body)); c != nil {
+			fn(c)
 		}
+	}
+}
 
-		ctx := &Context{
-			hw:    w,
-			house: house,
-			data:  msg,
-		}
-		fn(ctx)
+// newHTTPContext 根据请求参数 msg 检查房间密码、登录令牌和封禁，失败时写入错误响应并返回 nil
+func newHTTPContext(w http.ResponseWriter, r *http.Request, msg gjson.Result) *Context {
+	house := GetHouse(msg.Get("houseId").String())
+	if house == nil {
+		writeJSON(w, http.StatusNotFound, base.H{"error": "房间不存在"})
+		return nil
+	}
+	if !house.CheckPassword(msg.Get("password").String()) {
+		writeJSON(w, http.StatusUnauthorized, base.H{"error": "密码错误"})
+		return nil
+	}
+
+	token := sessionToken(r)
+	if token == "" {
+		token = msg.Get("token").String()
+	}
+	account, err := resolveUser(r, token)
+	if err != nil {
+		writeAccountError(w, err)
+		return nil
+	}
+
+	ip := maskIP(r.RemoteAddr)
+	user := auth.User{}
+	if account != nil {
+		user = *account
+	}
+	if house.Banned(user, ip) {
+		writeJSON(w, http.StatusForbidden, base.H{"error": "你已被禁止进入该房间"})
+		return nil
+	}
+
+	return &Context{
+		hw:      w,
+		ip:      ip,
+		addr:    remoteHost(r.RemoteAddr),
+		account: account,
+		house:   house,
+		action:  r.URL.Path,
+		data:    msg,
 	}
 }
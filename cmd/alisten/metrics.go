@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/bihua-university/alisten/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	houseCountDesc = prometheus.NewDesc(
+		"alisten_houses", "Number of houses.", nil, nil)
+	houseConnectionsDesc = prometheus.NewDesc(
+		"alisten_house_connections", "Number of WebSocket connections per house.", []string{"house"}, nil)
+	houseQueueDesc = prometheus.NewDesc(
+		"alisten_house_broadcast_queue", "Number of broadcast messages waiting to be sent per house.", []string{"house"}, nil)
+)
+
+// houseCollector 在采集时遍历所有房间，导出房间相关的指标
+type houseCollector struct{}
+
+func (houseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- houseCountDesc
+	ch <- houseConnectionsDesc
+	ch <- houseQueueDesc
+}
+
+func (houseCollector) Collect(ch chan<- prometheus.Metric) {
+	list := allHouses()
+	ch <- prometheus.MustNewConstMetric(houseCountDesc, prometheus.GaugeValue, float64(len(list)))
+	for _, h := range list {
+		h.Mu.Lock()
+		conns := len(h.Connection)
+		h.Mu.Unlock()
+		ch <- prometheus.MustNewConstMetric(houseConnectionsDesc, prometheus.GaugeValue, float64(conns), h.ID)
+		ch <- prometheus.MustNewConstMetric(houseQueueDesc, prometheus.GaugeValue, float64(h.queue.Len()), h.ID)
+	}
+}
+
+func init() {
+	metrics.Registry.MustRegister(houseCollector{})
+}
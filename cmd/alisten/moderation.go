@@ -0,0 +1,235 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/auth"
+	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/storage"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeKicked 被踢出房间时 WebSocket 的关闭码
+const closeKicked = 4001
+
+// Restriction 对用户或 IP 的限制，用于封禁和禁言
+type Restriction struct {
+	UserID string    // 账号 ID
+	IP     string    // 打码后的 IP，用于限制游客
+	Until  time.Time // 零值表示永久
+}
+
+func (r Restriction) match(u auth.User, ip string) bool {
+	if r.UserID != "" {
+		return r.UserID == u.ID
+	}
+	return r.IP != "" && r.IP == ip
+}
+
+func (r Restriction) expired(now time.Time) bool {
+	return !r.Until.IsZero() && now.After(r.Until)
+}
+
+// restricted 清理过期的限制并检查用户是否受到限制，调用方需持有 h.Mu
+func restricted(list *[]Restriction, u auth.User, ip string) bool {
+	now := time.Now()
+	*list = slices.DeleteFunc(*list, func(r Restriction) bool { return r.expired(now) })
+	return slices.ContainsFunc(*list, func(r Restriction) bool { return r.match(u, ip) })
+}
+
+// Banned 用户是否被禁止进入房间
+func (h *House) Banned(u auth.User, ip string) bool {
+	h.Mu.Lock()
+	defer h.Mu.Unlock()
+	return restricted(&h.Bans, u, ip)
+}
+
+// Muted 用户是否被禁言
+func (h *House) Muted(u auth.User, ip string) bool {
+	h.Mu.Lock()
+	defer h.Mu.Unlock()
+	return restricted(&h.Mutes, u, ip)
+}
+
+func toStorageRestrictions(list []Restriction) []storage.Restriction {
+	r := make([]storage.Restriction, 0, len(list))
+	for _, v := range list {
+		s := storage.Restriction{UserID: v.UserID, IP: v.IP}
+		if !v.Until.IsZero() {
+			s.Until = v.Until.UnixMilli()
+		}
+		r = append(r, s)
+	}
+	return r
+}
+
+func fromStorageRestrictions(list []storage.Restriction) []Restriction {
+	r := make([]Restriction, 0, len(list))
+	for _, v := range list {
+		s := Restriction{UserID: v.UserID, IP: v.IP}
+		if v.Until != 0 {
+			s.Until = time.UnixMilli(v.Until)
+		}
+		r = append(r, s)
+	}
+	return r
+}
+
+// Close 以 code 关闭 WebSocket 连接，读循环随后退出并离开房间
+func (c *Connection) Close(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	_ = c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	_ = c.conn.Close()
+}
+
+// moderationTarget 解析操作对象，userId 指定登录用户，name 指定在线用户的名称（用于游客）
+//
+// 返回匹配的在线连接和对应的限制，调用方需持有 h.Mu。actor 的角色必须高于所有目标。
+func (h *House) moderationTarget(actor Role, userID, name string) (conns []*Connection, targets []Restriction, ok bool) {
+	for _, conn := range h.Connection {
+		u := conn.user
+		if (userID != "" && u.ID == userID) || (userID == "" && name != "" && u.Name == name) {
+			if h.roleOf(u) >= actor {
+				return nil, nil, false
+			}
+			conns = append(conns, conn)
+			if u.IsGuest() {
+				targets = append(targets, Restriction{IP: conn.ip})
+			} else {
+				targets = append(targets, Restriction{UserID: u.ID})
+			}
+		}
+	}
+	if userID != "" {
+		if h.roleOf(auth.User{ID: userID}) >= actor {
+			return nil, nil, false
+		}
+		targets = append(targets, Restriction{UserID: userID})
+	}
+	return conns, slices.Compact(targets), true
+}
+
+// restrict 对目标用户添加限制，kick 为 true 时同时踢出房间
+func restrict(c *Context, list func(h *House) *[]Restriction, kick bool) (int, bool) {
+	actor := c.Role()
+	if actor < ModeratorRole {
+		c.Forbidden()
+		return 0, false
+	}
+	userID := c.Get("userId").String()
+	name := c.Get("name").String()
+	var until time.Time
+	if d := c.Get("duration").Int(); d > 0 {
+		until = time.Now().Add(time.Duration(d) * time.Second)
+	}
+
+	var conns []*Connection
+	var targets []Restriction
+	ok := true
+	c.WithHouse(func(h *House) {
+		conns, targets, ok = h.moderationTarget(actor, userID, name)
+		if !ok || list == nil {
+			return
+		}
+		l := list(h)
+		for _, t := range targets {
+			t.Until = until
+			*l = append(*l, t)
+		}
+	})
+	if !ok {
+		c.Forbidden()
+		return 0, false
+	}
+	if len(conns) == 0 && len(targets) == 0 {
+		c.Fail(http.StatusNotFound, "用户不在房间中")
+		return 0, false
+	}
+	if kick {
+		for _, conn := range conns {
+			conn.Close(closeKicked, "kicked")
+		}
+	}
+	if list != nil {
+		c.house.save()
+	}
+	return len(conns), true
+}
+
+// kickUser 将用户踢出房间，用户可以重新进入
+func kickUser(c *Context) {
+	n, ok := restrict(c, nil, true)
+	if !ok {
+		return
+	}
+	c.Send(base.H{"type": "house/kick", "count": n})
+}
+
+// banUser 封禁用户并踢出房间，duration 为封禁秒数，不指定则永久封禁
+func banUser(c *Context) {
+	n, ok := restrict(c, func(h *House) *[]Restriction { return &h.Bans }, true)
+	if !ok {
+		return
+	}
+	c.Send(base.H{"type": "house/ban", "count": n})
+}
+
+// muteUser 禁言用户，duration 为禁言秒数，不指定则永久禁言
+func muteUser(c *Context) {
+	n, ok := restrict(c, func(h *House) *[]Restriction { return &h.Mutes }, false)
+	if !ok {
+		return
+	}
+	c.Send(base.H{"type": "house/mute", "count": n})
+}
+
+// lift 解除限制，通过 userId 或 ip 指定
+func lift(c *Context, list func(h *House) *[]Restriction) bool {
+	if !c.Require(ModeratorRole) {
+		return false
+	}
+	userID := c.Get("userId").String()
+	ip := c.Get("ip").String()
+	c.WithHouse(func(h *House) {
+		l := list(h)
+		*l = slices.DeleteFunc(*l, func(r Restriction) bool {
+			return (userID != "" && r.UserID == userID) || (ip != "" && r.IP == ip)
+		})
+	})
+	c.house.save()
+	return true
+}
+
+func unbanUser(c *Context) {
+	if lift(c, func(h *House) *[]Restriction { return &h.Bans }) {
+		c.Send(base.H{"type": "house/unban"})
+	}
+}
+
+func unmuteUser(c *Context) {
+	if lift(c, func(h *House) *[]Restriction { return &h.Mutes }) {
+		c.Send(base.H{"type": "house/unmute"})
+	}
+}
+
+// restrictionList 返回房间的封禁和禁言列表
+func restrictionList(c *Context) {
+	if !c.Require(ModeratorRole) {
+		return
+	}
+	var data base.H
+	c.WithHouse(func(h *House) {
+		now := time.Now()
+		prune := func(r Restriction) bool { return r.expired(now) }
+		h.Bans = slices.DeleteFunc(h.Bans, prune)
+		h.Mutes = slices.DeleteFunc(h.Mutes, prune)
+		data = base.H{
+			"bans":  toStorageRestrictions(h.Bans),
+			"mutes": toStorageRestrictions(h.Mutes),
+		}
+	})
+	c.Send(base.H{"type": "house/restriction", "data": data})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bihua-university/alisten/internal/auth"
+)
+
+func TestModerationTarget(t *testing.T) {
+	h := &House{
+		Owner: "owner",
+		Connection: []*Connection{
+			{ip: "10.0.*.*", user: auth.User{ID: "u1", Name: "alice"}},
+			{ip: "10.1.*.*", user: auth.User{Name: "guest"}},
+			{ip: "10.2.*.*", user: auth.User{ID: "owner", Name: "bob"}},
+		},
+	}
+	tests := []struct {
+		userID, name string
+		want         []Restriction
+		ok           bool
+	}{
+		{userID: "u1", want: []Restriction{{UserID: "u1"}}, ok: true},
+		// 按名称匹配的登录用户按账号限制，游客按 IP 限制
+		{name: "alice", want: []Restriction{{UserID: "u1"}}, ok: true},
+		{name: "guest", want: []Restriction{{IP: "10.1.*.*"}}, ok: true},
+		{name: "bob", ok: false},
+	}
+	for _, tt := range tests {
+		conns, targets, ok := h.moderationTarget(OwnerRole, tt.userID, tt.name)
+		if ok != tt.ok || !slices.Equal(targets, tt.want) {
+			t.Errorf("moderationTarget(%q, %q) = %+v, %v, want %+v, %v", tt.userID, tt.name, targets, ok, tt.want, tt.ok)
+		}
+		if ok && len(conns) != 1 {
+			t.Errorf("moderationTarget(%q, %q) matched %d connections, want 1", tt.userID, tt.name, len(conns))
+		}
+	}
+}
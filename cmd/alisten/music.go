@@ -3,20 +3,99 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"slices"
 	"sort"
 	"strings"
-	"time"
 
 	"github.com/bihua-university/alisten/internal/auth"
 	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/metrics"
 	"github.com/bihua-university/alisten/internal/music"
 )
 
 type Order struct {
 	source string
-	id     string
+	id     string // 正在获取的按名字点歌为空
 	user   auth.User
+	guest  string // 点歌游客的标识，见 Context.GuestID
 	likes  int
+
+	// 异步点歌，见 doPickMusic
+	seq      uint64 // 点歌的序号，获取完成后用于找到对应的点歌，恢复的和推荐的歌曲为 0
+	status   orderStatus
+	keyword  string         // 点歌时的名称或关键词，获取完成前显示为歌名
+	progress *orderProgress // 获取进度
+	reason   string         // 获取失败的原因
+}
+
+// currentMusic 正在播放的歌曲
+//
+// 字段按 json 名称的字母序排列，与之前 map 序列化的输出保持一致。
+type currentMusic struct {
+	Album      string     `json:"album"`
+	Artist     string     `json:"artist"`
+	Duration   int64      `json:"duration"`
+	ID         string     `json:"id"`
+	Lyric      string     `json:"lyric"`
+	Name       string     `json:"name"`
+	PictureURL string     `json:"pictureUrl"`
+	PushTime   int64      `json:"pushTime"`
+	Source     string     `json:"source"`
+	Type       string     `json:"type"`
+	URL        string     `json:"url"`
+	User       *auth.User `json:"user,omitempty"` // 仅 HTTP 接口返回
+	WebURL     string     `json:"webUrl"`
+}
+
+func newCurrentMusic(t *music.Track, pushTime int64) *currentMusic {
+	return &currentMusic{
+		Album:      t.Album,
+		Artist:     t.Artist,
+		Duration:   t.Duration,
+		ID:         t.ID,
+		Lyric:      t.Lyric,
+		Name:       t.Name,
+		PictureURL: t.PictureURL,
+		PushTime:   pushTime,
+		Source:     t.Source,
+		Type:       t.Type,
+		URL:        t.URL,
+		WebURL:     t.WebURL,
+	}
+}
+
+// playlistItem 播放列表中的歌曲，不包含播放地址和歌词
+type playlistItem struct {
+	Album      string         `json:"album"`
+	Artist     string         `json:"artist"`
+	Duration   int64          `json:"duration"`
+	Error      string         `json:"error,omitempty"` // 获取失败的原因
+	Name       string         `json:"name"`
+	PictureURL string         `json:"pictureUrl"`
+	Progress   *orderProgress `json:"progress,omitempty"` // 正在获取的点歌的进度
+	Source     string         `json:"source"`
+	Status     string         `json:"status"` // ready、pending（正在获取）或 failed
+	Type       string         `json:"type"`
+	User       auth.User      `json:"user"`
+	WebURL     string         `json:"webUrl"`
+}
+
+func newPlaylistItem(t *music.Track, user auth.User) playlistItem {
+	if t == nil {
+		return playlistItem{User: user}
+	}
+	return playlistItem{
+		Status:     orderReady.String(),
+		Album:      t.Album,
+		Artist:     t.Artist,
+		Duration:   t.Duration,
+		Name:       t.Name,
+		PictureURL: t.PictureURL,
+		Source:     t.Source,
+		Type:       t.Type,
+		User:       user,
+		WebURL:     t.WebURL,
+	}
 }
 
 // PickMusicResult 点歌结果
@@ -27,74 +106,7 @@ type PickMusicResult struct {
 	Artist  string `json:"artist,omitempty"`
 	Source  string `json:"source,omitempty"`
 	ID      string `json:"id,omitempty"`
-}
-
-func doPickMusic(house *House, id, name, source string, user auth.User) PickMusicResult {
-	// 聊天点歌只有名字，没有ID的情况
-	if id == "" {
-		r := music.SearchMusic(music.SearchOption{
-			Source:   source,
-			Keyword:  name,
-			Page:     1,
-			PageSize: 10,
-		})
-		if len(r.Data) > 0 {
-			id = r.Data[0].ID
-		}
-	}
-
-	m := music.GetMusic(source, id, true)
-	url, ok := m["url"].(string)
-	if !ok || url == "" {
-		return PickMusicResult{
-			Success: false,
-			Message: "点歌失败，无法获取音乐信息",
-		}
-	}
-
-	same := false
-	house.Mu.Lock()
-	for _, o := range house.Playlist {
-		if o.id == id {
-			same = true
-			break
-		}
-	}
-	if !same {
-		house.Playlist = append(house.Playlist, Order{source: source, id: id, user: user})
-		house.lastOrderTime = time.Now()
-	}
-	house.Mu.Unlock()
-
-	if same {
-		return PickMusicResult{
-			Success: false,
-			Message: "重复点歌",
-		}
-	}
-
-	house.Update()
-	house.PushPlaylist()
-
-	// 获取实际的音乐名称
-	if actualName, ok := m["name"].(string); ok && actualName != "" {
-		name = actualName
-	}
-
-	artist := "unknown"
-
-	if a, ok := m["artist"].(string); ok && a != "" {
-		artist = a
-	}
-
-	return PickMusicResult{
-		Success: true,
-		Message: "点歌成功",
-		Name:    name,
-		Artist:  artist,
-		Source:  source,
-		ID:      id,
-	}
+	Err     error  `json:"-"` // 音乐源返回的错误
 }
 
 func searchMusic(c *Context) {
@@ -113,6 +125,12 @@ func searchMusic(c *Context) {
 	} else {
 		r = music.SearchMusic(o)
 	}
+	if r.Err != nil {
+		c.Error("搜索失败", r.Err)
+		if c.IsHTTP() {
+			return
+		}
+	}
 
 	if c.IsWebSocket() {
 		c.conn.Send(base.H{
@@ -131,16 +149,21 @@ func searchMusic(c *Context) {
 
 func deleteMusic(c *Context) {
 	if !c.house.Wait(WaitOrder) { // 与点歌共用
-		c.Info("操作过于频繁，请稍后再试")
+		c.Fail(http.StatusTooManyRequests, "操作过于频繁，请稍后再试")
 		return
 	}
 	name := c.Get("id").String()
+	user := c.User()
 
-	deleted := false
+	deleted, forbidden := false, false
 	c.WithHouse(func(h *House) {
 		for i, o := range h.Playlist {
-			m, _ := music.GetMusic(o.source, o.id, true)["name"].(string)
-			if m == name {
+			if n := o.name(); n != "" && n == name {
+				// 只能删除自己点的歌，房管可以删除所有人的
+				if o.user != user && h.roleOf(user) < ModeratorRole {
+					forbidden = true
+					return
+				}
 				deleted = true
 				h.Playlist = append(h.Playlist[:i], h.Playlist[i+1:]...)
 				return
@@ -148,7 +171,12 @@ func deleteMusic(c *Context) {
 		}
 	})
 
+	if forbidden {
+		c.Forbidden()
+		return
+	}
 	if deleted {
+		c.house.save()
 		c.house.PushPlaylist()
 		if c.IsWebSocket() {
 			c.Chat("删除音乐 " + name)
@@ -162,23 +190,7 @@ func deleteMusic(c *Context) {
 }
 
 func pickMusic(c *Context) {
-	if !c.house.Wait(WaitOrder) {
-		c.Info("操作过于频繁，请稍后再试")
-		return
-	}
-
-	// 限制点歌数量
-	exceed := false
-	c.WithHouse(func(h *House) {
-		if h.ultimate {
-			return
-		}
-		if len(h.Playlist) >= 10 {
-			exceed = true
-		}
-	})
-	if exceed {
-		c.Info("已超过最大点歌数量10首,请稍后再试!")
+	if !checkPick(c) {
 		return
 	}
 
@@ -187,11 +199,34 @@ func pickMusic(c *Context) {
 	source := c.Get("source").String()
 
 	// 调用核心点歌逻辑
-	result := doPickMusic(c.house, id, name, source, c.User())
+	respondPick(c, doPickMusic(c.house, id, name, source, c.User(), c.GuestID()))
+}
+
+// respondPick 点歌结果返回后通知用户
+//
+// WebSocket 点歌不等待结果，点歌已经显示在播放列表中；HTTP 点歌等待结果后返回。
+func respondPick(c *Context, result <-chan PickMusicResult) {
+	if c.IsWebSocket() {
+		go func() { sendPickResult(c, <-result) }()
+		return
+	}
+	sendPickResult(c, <-result)
+}
+
+// sendPickResult 向用户返回点歌结果
+func sendPickResult(c *Context, result PickMusicResult) {
+	if result.Err != nil {
+		c.Error(result.Message, result.Err)
+		return
+	}
 
-	if result.Success && c.IsWebSocket() {
-		// Push new playlist
-		c.Chat("点歌 " + result.Name)
+	if c.IsWebSocket() {
+		if result.Success {
+			// Push new playlist
+			c.Chat("点歌 " + result.Name)
+		} else {
+			c.Info(result.Message)
+		}
 	}
 	if c.IsHTTP() {
 		if result.Success {
@@ -207,15 +242,46 @@ func pickMusic(c *Context) {
 	}
 }
 
-func merge(h1, h2 base.H) base.H {
-	r := make(base.H, len(h1)+len(h2))
-	for k, v := range h1 {
-		r[k] = v
+// checkPick 检查房间的点歌频率、播放列表长度和用户的点歌限制，超出限制时通知用户并返回 false
+func checkPick(c *Context) bool {
+	if !c.house.Wait(WaitOrder) {
+		c.Fail(http.StatusTooManyRequests, "操作过于频繁，请稍后再试")
+		return false
 	}
-	for k, v := range h2 {
-		r[k] = v
+
+	// 限制点歌数量
+	exceed, limit := false, 0
+	c.WithHouse(func(h *House) {
+		exceed, limit = h.queueFull()
+	})
+	if exceed {
+		c.Fail(http.StatusTooManyRequests, fmt.Sprintf("已超过最大点歌数量%d首,请稍后再试!", limit))
+		return false
 	}
-	return r
+	return checkUserQuota(c)
+}
+
+// checkUserQuota 检查当前用户排队的歌曲数和点歌频率，超出限制时通知用户并返回 false
+func checkUserQuota(c *Context) bool {
+	user, guest := c.User(), c.GuestID()
+	queued, limit, allowed := 0, 0, true
+	c.WithHouse(func(h *House) {
+		queued, limit = h.userOrders(user, guest), h.userOrderLimit()
+		if limit <= 0 || queued < limit {
+			allowed = h.allowUserPick(user, guest)
+		}
+	})
+	if limit > 0 && queued >= limit {
+		metrics.RateLimited.WithLabelValues("user_queue").Inc()
+		c.Fail(http.StatusTooManyRequests, fmt.Sprintf("你已有%d首歌在排队，请等待播放后再点歌", queued))
+		return false
+	}
+	if !allowed {
+		metrics.RateLimited.WithLabelValues("user_pick").Inc()
+		c.Fail(http.StatusTooManyRequests, "点歌过于频繁，请稍后再试")
+		return false
+	}
+	return true
 }
 
 func voteSkip(c *Context) {
@@ -223,21 +289,16 @@ func voteSkip(c *Context) {
 	requiredVotes := 0
 	voteCount := 0
 	c.WithHouse(func(house *House) {
-		// 检查用户是否已投票
-		user := c.User()
-		for _, existingUser := range house.VoteSkip {
-			if user == existingUser {
-				voted = true
-				return
-			}
-		}
-
-		if !voted {
-			house.VoteSkip = append(house.VoteSkip, user)
+		// 检查用户是否已投票，登录用户按账号、游客按连接去重，修改名称不能重复投票
+		key := userKey(c.User(), c.GuestID())
+		if slices.Contains(house.VoteSkip, key) {
+			voted = true
+			return
 		}
+		house.VoteSkip = append(house.VoteSkip, key)
 
-		// 向上取整，至少需要三分之一的用户投票
-		requiredVotes = max((len(house.Connection)+2)/3, 1)
+		// 向上取整，默认至少需要三分之一的用户投票
+		requiredVotes = house.requiredVotes()
 		voteCount = len(c.house.VoteSkip)
 	})
 
@@ -250,7 +311,7 @@ func voteSkip(c *Context) {
 
 	// 如果票数达到要求，直接切歌
 	if voteCount >= requiredVotes {
-		c.house.Skip(true)
+		c.house.Skip(VoteSkipped)
 		if c.IsWebSocket() {
 			c.Chat("投票切歌成功")
 		}
@@ -269,7 +330,7 @@ func voteSkip(c *Context) {
 
 func goodMusic(c *Context) {
 	if !c.house.Wait(WaitLike) {
-		c.Info("操作过于频繁，请稍后再试")
+		c.Fail(http.StatusTooManyRequests, "操作过于频繁，请稍后再试")
 		return
 	}
 	index := c.Get("index").Int()
@@ -292,6 +353,7 @@ func goodMusic(c *Context) {
 		}
 	})
 	if change {
+		c.house.save()
 		c.house.PushPlaylist()
 		if c.IsWebSocket() {
 			c.Chat(fmt.Sprintf("%s 点赞%d", name, likes))
@@ -312,6 +374,12 @@ func searchList(c *Context) {
 		Page:     c.Get("pageIndex").Int(),
 		PageSize: c.Get("pageSize").Int(),
 	})
+	if r.Err != nil {
+		c.Error("搜索歌单失败", r.Err)
+		if c.IsHTTP() {
+			return
+		}
+	}
 
 	if c.IsWebSocket() {
 		c.conn.Send(base.H{
@@ -329,6 +397,14 @@ func searchList(c *Context) {
 }
 
 func playMode(c *Context) {
+	// 没有房主的房间保持原有行为，所有人都可以切换播放模式
+	ownerless := false
+	c.WithHouse(func(h *House) {
+		ownerless = h.Owner == ""
+	})
+	if !ownerless && !c.Require(ModeratorRole) {
+		return
+	}
 	mode := c.Get("mode").String()
 	c.WithHouse(func(house *House) {
 		switch mode {
@@ -336,8 +412,11 @@ func playMode(c *Context) {
 			house.Mode = NormalMode
 		case "random":
 			house.Mode = RandomMode
+		case "fair":
+			house.Mode = FairMode
 		}
 	})
+	c.house.save()
 
 	if c.IsHTTP() {
 		c.Send(base.H{"mode": mode})
@@ -348,18 +427,22 @@ func getCurrentMusic(c *Context) {
 	c.WithHouse(func(h *House) {
 		if h.Current.id != "" {
 			// 发送播放单曲
-			m := music.GetMusic(h.Current.source, h.Current.id, false)
-			r := merge(m, base.H{
-				"pushTime": h.PushTime,
-			})
+			t, err := music.GetMusic(h.Current.source, h.Current.id, false)
+			if err != nil {
+				if c.IsHTTP() {
+					c.Error("无法获取音乐信息", err)
+				}
+				return
+			}
+			r := newCurrentMusic(t, h.PushTime)
 
 			if c.IsWebSocket() {
 				c.conn.Send(r)
 			}
 			if c.IsHTTP() {
 				// ensure user who picked the song is included in HTTP response
-				// r already merged music fields and pushTime; add user if available
-				r["user"] = h.Current.user
+				user := h.Current.user
+				r.User = &user
 				c.Send(r)
 			}
 		} else if c.IsHTTP() {
@@ -377,14 +460,18 @@ func getPlaylist(c *Context) {
 		ID     string    `json:"id"`
 		Likes  int       `json:"likes"`
 		User   auth.User `json:"user"`
+		Status string    `json:"status"`
 	}
 
 	var list []item
 	c.WithHouse(func(house *House) {
 		for _, o := range house.Playlist {
-			m := music.GetMusic(o.source, o.id, true)
-			name, _ := m["name"].(string)
-			artist, _ := m["artist"].(string)
+			var name, artist string
+			if o.status != orderReady {
+				name = o.name()
+			} else if t, err := music.GetMusic(o.source, o.id, true); err == nil {
+				name, artist = t.Name, t.Artist
+			}
 			if artist == "" {
 				artist = "unknown"
 			}
@@ -395,6 +482,7 @@ func getPlaylist(c *Context) {
 				ID:     o.id,
 				Likes:  o.likes,
 				User:   o.user,
+				Status: o.status.String(),
 			})
 		}
 	})
@@ -415,7 +503,7 @@ func recommendMusic(c *Context) {
 	var list []string
 	c.WithHouse(func(h *House) {
 		for _, o := range h.Playlist {
-			if o.source != "wy" {
+			if o.source != "wy" || o.status != orderReady {
 				continue
 			}
 			list = append(list, o.id)
@@ -425,14 +513,17 @@ func recommendMusic(c *Context) {
 	recommand := c.house.recommander.Recommend(list)
 	var data []*music.Music
 	for _, id := range recommand {
-		m := music.GetMusic("wy", id, true)
+		t, err := music.GetMusic("wy", id, true)
+		if err != nil {
+			continue
+		}
 		data = append(data, &music.Music{
-			ID:       m["id"].(string),
-			Name:     m["name"].(string),
-			Artist:   m["artist"].(string),
-			Album:    m["album"].(string),
-			Duration: int64(m["duration"].(int64)),
-			Cover:    m["pictureUrl"].(string),
+			ID:       t.ID,
+			Name:     t.Name,
+			Artist:   t.Artist,
+			Album:    t.Album,
+			Duration: t.Duration,
+			Cover:    t.PictureURL,
 			Source:   music.NetEase,
 		})
 	}
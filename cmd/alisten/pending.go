@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/auth"
+	"github.com/bihua-university/alisten/internal/music"
+	"github.com/bihua-university/alisten/internal/task"
+)
+
+const (
+	// pendingPushInterval 点歌进度广播的最小间隔，阶段变化时立即广播
+	pendingPushInterval = 500 * time.Millisecond
+	// failedOrderTTL 获取失败的点歌在播放列表中保留的时间
+	failedOrderTTL = 10 * time.Second
+)
+
+// orderStatus 点歌的状态，点歌先以 orderPending 加入播放列表，在后台获取歌曲信息
+type orderStatus int
+
+const (
+	orderReady   orderStatus = iota // 可以播放，恢复的和推荐的歌曲都是该状态
+	orderPending                    // 正在获取歌曲信息，切歌时跳过
+	orderFailed                     // 获取失败，一段时间后从播放列表中移除
+)
+
+func (s orderStatus) String() string {
+	switch s {
+	case orderReady:
+		return "ready"
+	case orderPending:
+		return "pending"
+	case orderFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// orderProgress 点歌的获取进度
+type orderProgress struct {
+	Stage   string  `json:"stage"`
+	Percent float64 `json:"percent,omitempty"`
+
+	pushed time.Time // 上次广播进度的时间
+}
+
+// name 返回点歌的歌名，尚未获取到歌曲信息时返回点歌时的名称
+func (o Order) name() string {
+	if o.status == orderReady {
+		if t, err := music.GetMusic(o.source, o.id, true); err == nil {
+			return t.Name
+		}
+		return ""
+	}
+	if o.keyword != "" {
+		return o.keyword
+	}
+	return o.id
+}
+
+// item 尚未获取到歌曲信息的点歌在播放列表中的显示
+func (o Order) item() playlistItem {
+	var progress *orderProgress
+	if o.progress != nil {
+		p := *o.progress
+		progress = &p
+	}
+	return playlistItem{
+		Error:    o.reason,
+		Name:     o.name(),
+		Progress: progress,
+		Source:   o.source,
+		Status:   o.status.String(),
+		User:     o.user,
+	}
+}
+
+// orderIndex 返回序号为 seq 的点歌在播放列表中的位置，不存在时返回 -1，调用方需持有 h.Mu
+func (h *House) orderIndex(seq uint64) int {
+	return slices.IndexFunc(h.Playlist, func(o Order) bool { return o.seq == seq })
+}
+
+// doPickMusic 点歌核心逻辑，HTTP 和 WebSocket 点歌共用
+//
+// 点歌立即以 orderPending 加入播放列表，歌曲信息在后台获取，
+// 获取结束后点歌结果写入返回的 channel。
+func doPickMusic(house *House, id, name, source string, user auth.User, guest string) <-chan PickMusicResult {
+	result := make(chan PickMusicResult, 1)
+
+	// 上传的歌曲只能在上传所在的房间点播
+	if source == music.UploadSource && !uploadedIn(id, house.ID) {
+		result <- PickMusicResult{Success: false, Message: "只能点本房间上传的歌曲"}
+		return result
+	}
+
+	var seq uint64
+	same := false
+	house.lock(func() {
+		if id != "" && slices.ContainsFunc(house.Playlist, func(o Order) bool {
+			return o.id == id && o.status != orderFailed
+		}) {
+			same = true
+			return
+		}
+		house.orderSeq++
+		seq = house.orderSeq
+		house.Playlist = append(house.Playlist, Order{
+			source:  source,
+			id:      id,
+			user:    user,
+			guest:   guest,
+			seq:     seq,
+			status:  orderPending,
+			keyword: name,
+		})
+		house.lastOrderTime = time.Now()
+	})
+	if same {
+		result <- PickMusicResult{Success: false, Message: "重复点歌"}
+		return result
+	}
+
+	house.PushPlaylist()
+	go func() {
+		result <- house.resolveOrder(seq, id, name, source)
+	}()
+	return result
+}
+
+// resolveOrder 获取点歌的歌曲信息，成功时标记为可以播放，失败时标记为失败
+func (h *House) resolveOrder(seq uint64, id, name, source string) PickMusicResult {
+	fail := func(err error) PickMusicResult {
+		h.failOrder(seq, musicError(err).msg)
+		return PickMusicResult{Success: false, Message: "点歌失败", Err: err}
+	}
+
+	// 聊天点歌只有名字，没有ID的情况
+	if id == "" {
+		r := music.SearchMusic(music.SearchOption{
+			Source:   source,
+			Keyword:  name,
+			Page:     1,
+			PageSize: 10,
+		})
+		if r.Err == nil && len(r.Data) == 0 {
+			r.Err = fmt.Errorf("%w: no result for %q", music.ErrNotFound, name)
+		}
+		if r.Err != nil {
+			return fail(r.Err)
+		}
+		id = r.Data[0].ID
+	}
+
+	t, err := music.GetMusicProgress(source, id, true, func(p task.Progress) {
+		h.updateProgress(seq, p)
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	found, same := false, false
+	h.lock(func() {
+		i := h.orderIndex(seq)
+		if i < 0 {
+			// 获取期间点歌被删除或播放列表被清空
+			return
+		}
+		found = true
+		same = slices.ContainsFunc(h.Playlist, func(o Order) bool {
+			return o.seq != seq && o.id == id && o.status != orderFailed
+		})
+		if same {
+			h.Playlist = slices.Delete(h.Playlist, i, i+1)
+			return
+		}
+		h.Playlist[i].id = id
+		h.Playlist[i].status = orderReady
+		h.Playlist[i].progress = nil
+	})
+	if !found {
+		return PickMusicResult{Success: false, Message: "点歌已取消"}
+	}
+	h.PushPlaylist()
+	if same {
+		return PickMusicResult{Success: false, Message: "重复点歌"}
+	}
+
+	h.save()
+	h.Update()
+
+	// 获取实际的音乐名称
+	if t.Name != "" {
+		name = t.Name
+	}
+
+	artist := "unknown"
+	if t.Artist != "" {
+		artist = t.Artist
+	}
+
+	return PickMusicResult{
+		Success: true,
+		Message: "点歌成功",
+		Name:    name,
+		Artist:  artist,
+		Source:  source,
+		ID:      id,
+	}
+}
+
+// updateProgress 更新点歌的获取进度，阶段变化或距离上次广播超过 pendingPushInterval 时广播播放列表
+func (h *House) updateProgress(seq uint64, p task.Progress) {
+	push := false
+	h.lock(func() {
+		i := h.orderIndex(seq)
+		if i < 0 || h.Playlist[i].status != orderPending {
+			return
+		}
+		o := &h.Playlist[i]
+		if o.progress == nil {
+			o.progress = &orderProgress{}
+		}
+		push = p.Stage != o.progress.Stage || time.Since(o.progress.pushed) >= pendingPushInterval
+		o.progress.Stage, o.progress.Percent = p.Stage, p.Percent
+		if push {
+			o.progress.pushed = time.Now()
+		}
+	})
+	if push {
+		// 进度在 worker 的请求中报告，推送播放列表可能需要获取歌曲信息，不阻塞 worker
+		go h.PushPlaylist()
+	}
+}
+
+// failOrder 将点歌标记为失败，failedOrderTTL 后从播放列表中移除
+func (h *House) failOrder(seq uint64, reason string) {
+	found := false
+	h.lock(func() {
+		if i := h.orderIndex(seq); i >= 0 {
+			found = true
+			h.Playlist[i].status = orderFailed
+			h.Playlist[i].reason = reason
+			h.Playlist[i].progress = nil
+		}
+	})
+	if !found {
+		return
+	}
+	h.PushPlaylist()
+
+	time.AfterFunc(failedOrderTTL, func() {
+		removed := false
+		h.lock(func() {
+			if i := h.orderIndex(seq); i >= 0 {
+				h.Playlist = slices.Delete(h.Playlist, i, i+1)
+				removed = true
+			}
+		})
+		if removed {
+			h.PushPlaylist()
+		}
+	})
+}
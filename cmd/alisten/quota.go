@@ -0,0 +1,98 @@
+package main
+
+import (
+	"time"
+
+	"github.com/bihua-university/alisten/internal/auth"
+
+	"golang.org/x/time/rate"
+)
+
+// userKey 区分用户的键，登录用户使用账号 ID，游客使用 guest 标识（见 Context.GuestID）
+//
+// 游客可以随意修改名称，只有没有标识的点歌（如系统推荐）才按名称区分。
+func userKey(u auth.User, guest string) string {
+	switch {
+	case !u.IsGuest():
+		return "id:" + u.ID
+	case guest != "":
+		return "guest:" + guest
+	default:
+		return "name:" + u.Name
+	}
+}
+
+// key 返回点歌用户的键
+func (o Order) key() string {
+	return userKey(o.user, o.guest)
+}
+
+// userOrders 返回用户在播放列表中排队的歌曲数，调用方需持有 h.Mu
+func (h *House) userOrders(u auth.User, guest string) int {
+	key := userKey(u, guest)
+	n := 0
+	for _, o := range h.Playlist {
+		if o.status != orderFailed && o.key() == key {
+			n++
+		}
+	}
+	return n
+}
+
+// userOrderLimit 每人最多排队的歌曲数，小于等于 0 时不限制，调用方需持有 h.Mu
+func (h *House) userOrderLimit() int {
+	return h.effectiveLimits().UserQueue
+}
+
+// allowUserPick 检查用户的点歌频率，调用方需持有 h.Mu
+func (h *House) allowUserPick(u auth.User, guest string) bool {
+	n := h.effectiveLimits().UserOrder
+	if n <= 0 {
+		return true
+	}
+	key := userKey(u, guest)
+	l, ok := h.userLimiters[key]
+	if !ok {
+		if len(h.userLimiters) >= 256 {
+			// 清理已恢复满额的限制器，避免长期运行的房间无限增长
+			for k, v := range h.userLimiters {
+				if v.Tokens() >= float64(v.Burst()) {
+					delete(h.userLimiters, k)
+				}
+			}
+		}
+		l = rate.NewLimiter(rate.Every(time.Minute/time.Duration(n)), n)
+		h.userLimiters[key] = l
+	}
+	return l.Allow()
+}
+
+// markServed 记录点歌用户的歌曲开始播放的时间，调用方需持有 h.Mu
+func (h *House) markServed(o Order) {
+	h.lastServed[o.key()] = time.Now()
+}
+
+// nextFair 返回公平模式下下一首歌在播放列表中的位置，调用方需持有 h.Mu
+//
+// 在有歌曲排队的用户中选择距离上次播放最久的用户（从未播放过的最优先），
+// 播放该用户最早点的歌；等待时间相同时按播放列表顺序选择。尚未获取到歌曲信息的点歌不参与选择。
+func (h *House) nextFair() int {
+	choose := -1
+	var oldest time.Time
+	seen := make(map[string]struct{})
+	for i, o := range h.Playlist {
+		if o.status != orderReady {
+			continue
+		}
+		key := o.key()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		last := h.lastServed[key]
+		if choose < 0 || last.Before(oldest) {
+			choose, oldest = i, last
+		}
+	}
+	return choose
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bihua-university/alisten/internal/auth"
+	"github.com/bihua-university/alisten/internal/base"
+
+	"golang.org/x/time/rate"
+)
+
+// TestGuestQuota 游客修改名称后仍然按标识计算排队数和点歌频率，同一网段的其他游客不受影响
+func TestGuestQuota(t *testing.T) {
+	h := &House{
+		limits:       base.Limits{UserQueue: 2, UserOrder: 1},
+		userLimiters: make(map[string]*rate.Limiter),
+		Playlist: []Order{
+			{id: "1", user: auth.User{Name: "a(10.0.*.*)"}, guest: "conn:a"},
+			{id: "2", user: auth.User{Name: "b(10.0.*.*)"}, guest: "conn:a"},
+			{id: "3", user: auth.User{Name: "a(10.1.*.*)"}, guest: "conn:b"},
+		},
+	}
+	renamed := auth.User{Name: "c(10.0.*.*)"}
+	if n, limit := h.userOrders(renamed, "conn:a"), h.userOrderLimit(); n != 2 || limit != 2 {
+		t.Errorf("userOrders() = %d of %d, want 2 of 2", n, limit)
+	}
+	if !h.allowUserPick(auth.User{Name: "a(10.0.*.*)"}, "conn:a") {
+		t.Errorf("allowUserPick() = false on first pick")
+	}
+	if h.allowUserPick(renamed, "conn:a") {
+		t.Errorf("allowUserPick() = true after renaming, want false")
+	}
+	if !h.allowUserPick(auth.User{Name: "a(10.0.*.*)"}, "conn:c") {
+		t.Errorf("allowUserPick() = false for another guest in the same subnet")
+	}
+	if !h.allowUserPick(auth.User{ID: "u1", Name: "a"}, "conn:a") {
+		t.Errorf("allowUserPick() = false for an account on the same connection")
+	}
+}
+
+// TestRequiredVotes 同一网段的游客分别计票，同一账号的多个连接只算一人
+func TestRequiredVotes(t *testing.T) {
+	h := &House{limits: base.Limits{VoteSkip: 1}}
+	for i, u := range []auth.User{{Name: "a(10.0.*.*)"}, {Name: "b(10.0.*.*)"}, {ID: "u1"}, {ID: "u1"}} {
+		h.Connection = append(h.Connection, &Connection{ip: "10.0.*.*", guest: fmt.Sprintf("conn:%d", i), user: u})
+	}
+	if n := h.requiredVotes(); n != 3 {
+		t.Errorf("requiredVotes() = %d, want 3", n)
+	}
+}
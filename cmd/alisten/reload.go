@@ -0,0 +1,127 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/music"
+	"github.com/bihua-university/alisten/internal/task"
+)
+
+// configWatchInterval 检查配置文件是否修改的间隔
+const configWatchInterval = 5 * time.Second
+
+// watchConfig 收到 SIGHUP 或配置文件修改时重新加载配置
+func watchConfig() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		modTime := configModTime()
+		ticker := time.NewTicker(configWatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hup:
+				modTime = configModTime()
+				slog.Info("received SIGHUP, reloading config")
+			case <-ticker.C:
+				t := configModTime()
+				if t.Equal(modTime) {
+					continue
+				}
+				modTime = t
+				slog.Info("config file changed, reloading config", "path", base.ConfigPath())
+			}
+			reloadConfig()
+		}
+	}()
+}
+
+func configModTime() time.Time {
+	fi, err := os.Stat(base.ConfigPath())
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// reloadConfig 重新加载配置并应用到运行中的服务，不会断开 WebSocket 连接
+//
+// 持久化房间、Cookie、令牌、频率限制、任务重试策略、本地曲库、上传和日志配置立即生效，
+// 监听地址、数据库和签名密钥需要重启后生效。
+func reloadConfig() {
+	old, err := base.ReloadConfig()
+	if err != nil {
+		slog.Error("reload config, keeping the previous config", "error", err)
+		return
+	}
+	c := base.Current()
+
+	base.InitLogger()
+	if c.Cookie != old.Cookie {
+		music.SetCookie(c.Cookie)
+	}
+	if c.Token != old.Token {
+		task.Scheduler.SetToken(c.Token)
+	}
+	task.Scheduler.SetRetryPolicies(retryPolicies(c))
+	applyLocalLibrary(c)
+	applyUploadLibrary(c)
+	for _, p := range c.Persist {
+		applyPersistHouse(p)
+	}
+	reapplyLimits()
+
+	if c.Addr != old.Addr || c.Pgsql != old.Pgsql || c.Secret != old.Secret || c.Debug != old.Debug {
+		slog.Warn("addr, pgsql, auth.secret and debug changes take effect after restart")
+	}
+	slog.Info("config reloaded", "persist", len(c.Persist))
+}
+
+// applyPersistHouse 按配置更新持久化房间，房间不存在时创建，已在线的连接不受影响
+func applyPersistHouse(p base.PersistHouse) {
+	h := GetHouse(p.ID)
+	if h == nil {
+		if shuttingDown.Load() {
+			return
+		}
+		createHouse(p.ID, p.Name, p.Desc, p.Password, p.Owner, true, persistState(p, nil))
+		return
+	}
+	h.lock(func() {
+		h.Name, h.Desc, h.Password = p.Name, p.Desc, p.Password
+		if p.Owner != "" && p.Owner != h.Owner {
+			h.Owner = p.Owner
+			h.Moderators = slices.DeleteFunc(h.Moderators, func(id string) bool { return id == p.Owner })
+		}
+		h.ultimate = true
+		if p.Limits != (base.Limits{}) {
+			h.limits = p.Limits
+		}
+		h.applyLimits()
+	})
+	h.save()
+}
+
+// retryPolicies 将配置中的任务重试策略转换为 task.RetryPolicy，"*" 为默认策略
+func retryPolicies(c base.Configuration) map[string]task.RetryPolicy {
+	policies := make(map[string]task.RetryPolicy, len(c.TaskRetry))
+	for t, r := range c.TaskRetry {
+		if t == "*" {
+			t = ""
+		}
+		policies[t] = task.RetryPolicy{
+			Attempts:       r.Attempts,
+			Lease:          time.Duration(r.Lease) * time.Second,
+			Backoff:        time.Duration(r.Backoff) * time.Second,
+			RetryOnFailure: r.RetryOnFailure,
+		}
+	}
+	return policies
+}
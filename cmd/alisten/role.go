@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/bihua-university/alisten/internal/auth"
+	"github.com/bihua-university/alisten/internal/base"
+)
+
+type Role int
+
+const (
+	MemberRole Role = iota
+	ModeratorRole
+	OwnerRole
+)
+
+func (r Role) String() string {
+	switch r {
+	case MemberRole:
+		return "member"
+	case ModeratorRole:
+		return "moderator"
+	case OwnerRole:
+		return "owner"
+	default:
+		return "unknown"
+	}
+}
+
+// roleOf 返回用户在房间中的角色，调用方需持有 h.Mu
+//
+// 没有房主的房间（游客创建或未配置房主的持久化房间）中所有人都是普通成员，
+// 可以通过管理接口指定房主。
+func (h *House) roleOf(u auth.User) Role {
+	switch {
+	case h.Owner == "", u.IsGuest():
+		return MemberRole
+	case u.ID == h.Owner:
+		return OwnerRole
+	case slices.Contains(h.Moderators, u.ID):
+		return ModeratorRole
+	default:
+		return MemberRole
+	}
+}
+
+// Role 返回当前用户在房间中的角色
+func (c *Context) Role() Role {
+	var r Role
+	u := c.User()
+	c.WithHouse(func(h *House) {
+		r = h.roleOf(u)
+	})
+	return r
+}
+
+// Require 检查当前用户是否具有 role 及以上的角色，没有权限时通知用户并返回 false
+func (c *Context) Require(role Role) bool {
+	if c.Role() >= role {
+		return true
+	}
+	c.Forbidden()
+	return false
+}
+
+// Forbidden 通知用户没有权限执行该操作
+func (c *Context) Forbidden() {
+	c.Fail(http.StatusForbidden, "没有权限执行该操作")
+}
+
+// forceSkip 房管切歌
+func forceSkip(c *Context) {
+	if !c.Require(ModeratorRole) {
+		return
+	}
+	c.house.Skip(ForceSkipped)
+	if c.IsWebSocket() {
+		c.Chat("切歌")
+	}
+	if c.IsHTTP() {
+		c.Send(base.H{"message": "切歌成功"})
+	}
+}
+
+// clearMusic 清空播放列表
+func clearMusic(c *Context) {
+	if !c.Require(ModeratorRole) {
+		return
+	}
+	count := 0
+	c.WithHouse(func(h *House) {
+		count = len(h.Playlist)
+		h.Playlist = make([]Order, 0)
+	})
+	c.house.save()
+	c.house.PushPlaylist()
+	if c.IsWebSocket() {
+		c.Chat("清空播放列表")
+	}
+	if c.IsHTTP() {
+		c.Send(base.H{"count": count})
+	}
+}
+
+// editHouse 修改房间名称、描述和密码，未提供的字段保持不变
+func editHouse(c *Context) {
+	if !c.Require(OwnerRole) {
+		return
+	}
+	c.WithHouse(func(h *House) {
+		if v := c.Get("name"); v.Exists() {
+			h.Name = v.String()
+		}
+		if v := c.Get("desc"); v.Exists() {
+			h.Desc = v.String()
+		}
+		if v := c.Get("newPassword"); v.Exists() {
+			h.Password = v.String()
+		}
+	})
+	c.house.save()
+	if c.IsWebSocket() {
+		c.Info("房间信息已更新")
+	}
+	if c.IsHTTP() {
+		c.Send(base.H{"message": "房间信息已更新"})
+	}
+}
+
+// addModerator 房主添加房管，id 为账号 ID
+func addModerator(c *Context) {
+	if !c.Require(OwnerRole) {
+		return
+	}
+	id := c.Get("userId").String()
+	if id == "" {
+		c.Fail(http.StatusBadRequest, "用户不存在")
+		return
+	}
+	var list []string
+	c.WithHouse(func(h *House) {
+		if !slices.Contains(h.Moderators, id) && id != h.Owner {
+			h.Moderators = append(h.Moderators, id)
+		}
+		list = slices.Clone(h.Moderators)
+	})
+	c.house.save()
+	c.Send(base.H{"type": "house/moderator", "data": list})
+}
+
+// removeModerator 房主移除房管
+func removeModerator(c *Context) {
+	if !c.Require(OwnerRole) {
+		return
+	}
+	id := c.Get("userId").String()
+	var list []string
+	c.WithHouse(func(h *House) {
+		h.Moderators = slices.DeleteFunc(h.Moderators, func(m string) bool { return m == id })
+		list = slices.Clone(h.Moderators)
+	})
+	c.house.save()
+	c.Send(base.H{"type": "house/moderator", "data": list})
+}
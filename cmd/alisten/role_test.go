@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bihua-university/alisten/internal/auth"
+)
+
+func TestRoleOf(t *testing.T) {
+	owned := &House{Owner: "owner", Moderators: []string{"mod"}}
+	ownerless := &House{}
+	tests := []struct {
+		h    *House
+		u    auth.User
+		want Role
+	}{
+		{owned, auth.User{ID: "owner"}, OwnerRole},
+		{owned, auth.User{ID: "mod"}, ModeratorRole},
+		{owned, auth.User{ID: "other"}, MemberRole},
+		{owned, auth.User{Name: "guest"}, MemberRole},
+		// 没有房主的房间中所有人都是普通成员
+		{ownerless, auth.User{ID: "other"}, MemberRole},
+		{ownerless, auth.User{Name: "guest"}, MemberRole},
+	}
+	for _, tt := range tests {
+		if got := tt.h.roleOf(tt.u); got != tt.want {
+			t.Errorf("roleOf(%+v) in house owned by %q = %v, want %v", tt.u, tt.h.Owner, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/task"
+
+	"github.com/caddyserver/certmagic"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// shutdownTimeout 等待 HTTP 请求结束的最长时间
+	shutdownTimeout = 10 * time.Second
+	// noticeDelay 广播重启通知后等待消息发出的时间
+	noticeDelay = 500 * time.Millisecond
+	// reconnectDelay 建议客户端重新连接前等待的时间
+	reconnectDelay = 3 * time.Second
+)
+
+// shuttingDown 服务器正在关闭，不再创建房间和接受新连接
+var shuttingDown atomic.Bool
+
+// serve 启动 HTTP 服务，ctx 结束后优雅关闭服务器
+//
+// 调试模式监听 :8080，否则通过 certmagic 自动申请证书，
+// 监听 :443 提供服务并在 :80 处理 ACME 验证和 HTTPS 跳转。
+func serve(ctx context.Context, handler http.Handler) error {
+	c := base.Current()
+	var servers []*http.Server
+	var start []func() error
+	if c.Debug {
+		srv := &http.Server{Addr: ":8080", Handler: handler}
+		servers = append(servers, srv)
+		start = append(start, srv.ListenAndServe)
+	} else {
+		certmagic.DefaultACME.Agreed = true
+		cfg := certmagic.NewDefault()
+		if err := cfg.ManageSync(ctx, []string{c.Addr}); err != nil {
+			return err
+		}
+		tlsConfig := cfg.TLSConfig()
+		tlsConfig.NextProtos = append([]string{"h2", "http/1.1"}, tlsConfig.NextProtos...)
+
+		var redirect http.Handler = http.HandlerFunc(redirectHTTPS)
+		if am, ok := cfg.Issuers[0].(*certmagic.ACMEIssuer); ok {
+			redirect = am.HTTPChallengeHandler(redirect)
+		}
+		httpSrv := &http.Server{
+			Addr:              ":80",
+			Handler:           redirect,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		httpsSrv := &http.Server{
+			Addr:              ":443",
+			Handler:           handler,
+			TLSConfig:         tlsConfig,
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       5 * time.Minute,
+		}
+		servers = append(servers, httpSrv, httpsSrv)
+		start = append(start, httpSrv.ListenAndServe, func() error {
+			return httpsSrv.ListenAndServeTLS("", "")
+		})
+	}
+
+	errc := make(chan error, len(start))
+	for _, fn := range start {
+		go func() {
+			errc <- fn()
+		}()
+	}
+	slog.Info("server started", "addr", c.Addr, "debug", c.Debug)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	drain(servers)
+	return nil
+}
+
+func redirectHTTPS(w http.ResponseWriter, r *http.Request) {
+	u := *r.URL
+	u.Scheme, u.Host = "https", r.Host
+	http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+}
+
+// drain 关闭服务器：
+// 停止创建房间和接受新连接，通知客户端服务器正在重启，使等待中的任务失败，
+// 等待 HTTP 请求结束，保存所有房间并关闭房间和连接，最后关闭存储。
+func drain(servers []*http.Server) {
+	slog.Info("shutting down")
+	shuttingDown.Store(true)
+
+	list := allHouses()
+	for _, h := range list {
+		h.Broadcast(base.H{
+			"type":      "info/push",
+			"info":      "服务器正在重启，请稍后重新连接",
+			"system":    true,
+			"reconnect": reconnectDelay.Milliseconds(),
+		})
+	}
+	time.Sleep(noticeDelay)
+
+	task.Scheduler.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("http shutdown", "addr", srv.Addr, "error", err)
+		}
+	}
+
+	for _, h := range allHouses() {
+		h.save()
+		h.shutdown(websocket.CloseServiceRestart, "server restarting", false)
+	}
+	if err := store.Close(); err != nil {
+		slog.Warn("close storage", "error", err)
+	}
+	slog.Info("shutdown complete", "houses", len(list))
+}
+
+// allHouses 返回所有房间
+func allHouses() []*House {
+	housesMu.Lock()
+	defer housesMu.Unlock()
+	list := make([]*House, 0, len(houses))
+	for _, h := range houses {
+		list = append(list, h)
+	}
+	return list
+}
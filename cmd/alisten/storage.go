@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/storage"
+)
+
+var store storage.Store = storage.NewMemory()
+
+const storeTimeout = 5 * time.Second
+
+func toStorageOrder(o Order) storage.Order {
+	return storage.Order{Source: o.source, ID: o.id, User: o.user, Guest: o.guest, Likes: o.likes}
+}
+
+func fromStorageOrder(o storage.Order) Order {
+	return Order{source: o.Source, id: o.ID, user: o.User, guest: o.Guest, likes: o.Likes}
+}
+
+// snapshot 导出房间的持久化状态，调用方需持有 h.Mu
+func (h *House) snapshot() *storage.House {
+	s := &storage.House{
+		ID:         h.ID,
+		Name:       h.Name,
+		Desc:       h.Desc,
+		Password:   h.Password,
+		Owner:      h.Owner,
+		Moderators: slices.Clone(h.Moderators),
+		Ultimate:   h.ultimate,
+		Limits:     h.limits,
+		Mode:       int(h.Mode),
+		PushTime:   h.PushTime,
+		End:        h.End.UnixMilli(),
+		Playlist:   make([]storage.Order, 0, len(h.Playlist)),
+		Bans:       toStorageRestrictions(h.Bans),
+		Mutes:      toStorageRestrictions(h.Mutes),
+		History:    toStorageHistory(h.History),
+	}
+	if h.Current.id != "" {
+		o := toStorageOrder(h.Current)
+		s.Current = &o
+	}
+	for _, o := range h.Playlist {
+		// 正在获取的点歌重启后无法继续，不保存
+		if o.status == orderReady {
+			s.Playlist = append(s.Playlist, toStorageOrder(o))
+		}
+	}
+	return s
+}
+
+// restore 从持久化状态恢复播放列表和当前播放，在房间启动前调用
+func (h *House) restore(s *storage.House) {
+	if h.Owner == "" {
+		h.Owner = s.Owner
+	}
+	h.Moderators = s.Moderators
+	h.limits = s.Limits
+	h.Bans = fromStorageRestrictions(s.Bans)
+	h.Mutes = fromStorageRestrictions(s.Mutes)
+	h.History = fromStorageHistory(s.History)
+	h.Mode = Mode(s.Mode)
+	for _, o := range s.Playlist {
+		h.Playlist = append(h.Playlist, fromStorageOrder(o))
+	}
+	if s.Current != nil {
+		h.Current = fromStorageOrder(*s.Current)
+		h.PushTime = s.PushTime
+		h.End = time.UnixMilli(s.End)
+	}
+}
+
+// save 将房间状态写入存储
+func (h *House) save() {
+	h.saveMu.Lock()
+	defer h.saveMu.Unlock()
+	if h.forgotten {
+		return
+	}
+
+	var s *storage.House
+	h.lock(func() {
+		s = h.snapshot()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := store.SaveHouse(ctx, s); err != nil {
+		slog.Error("save house", base.LogHouse, h.ID, "error", err)
+	}
+}
+
+// forget 从存储中删除房间，之后的 save 不再生效
+func (h *House) forget() {
+	h.saveMu.Lock()
+	defer h.saveMu.Unlock()
+	h.forgotten = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := store.DeleteHouse(ctx, h.ID); err != nil {
+		slog.Error("delete house", base.LogHouse, h.ID, "error", err)
+	}
+}
+
+// openStore 根据配置打开存储
+func openStore() {
+	s, err := storage.Open(base.Config.Pgsql)
+	if err != nil {
+		slog.Error("open storage", "error", err)
+		os.Exit(1)
+	}
+	store = s
+}
+
+// initHouses 创建配置文件中的持久化房间并恢复其余已保存的房间
+func initHouses() {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	saved, err := store.LoadHouses(ctx)
+	if err != nil {
+		slog.Error("load houses", "error", err)
+		os.Exit(1)
+	}
+	states := make(map[string]*storage.House, len(saved))
+	for _, h := range saved {
+		states[h.ID] = h
+	}
+
+	// 创建持久化房间，房间信息以配置文件为准，配置文件未指定房主时使用已保存的房主
+	for _, p := range base.Config.Persist {
+		createHouse(p.ID, p.Name, p.Desc, p.Password, p.Owner, true, persistState(p, states[p.ID]))
+		delete(states, p.ID)
+	}
+	// 恢复通过 /house/add 或管理接口创建的房间，持久化房间需要通过管理接口删除
+	for _, s := range saved {
+		if _, ok := states[s.ID]; !ok {
+			continue
+		}
+		createHouse(s.ID, s.Name, s.Desc, s.Password, s.Owner, s.Ultimate, s)
+	}
+}
+
+// persistState 将配置文件中持久化房间的频率限制合并到已保存的状态，配置未指定时使用已保存的值
+func persistState(p base.PersistHouse, state *storage.House) *storage.House {
+	if p.Limits == (base.Limits{}) {
+		return state
+	}
+	if state == nil {
+		state = &storage.House{}
+	}
+	state.Limits = p.Limits
+	return state
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/auth"
+	"github.com/bihua-university/alisten/internal/storage"
+)
+
+// TestSnapshotRestore 房间状态保存后重新加载应保持不变
+func TestSnapshotRestore(t *testing.T) {
+	until := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+	h := &House{
+		ID:         "room",
+		Name:       "音乐房间",
+		Owner:      "owner",
+		Moderators: []string{"mod"},
+		Bans: []Restriction{
+			{UserID: "u1"},
+			{IP: "10.0.*.*", Until: until},
+		},
+		Mutes:    []Restriction{{UserID: "u2", Until: until}},
+		Mode:     FairMode,
+		Current:  Order{source: "wy", id: "1", user: auth.User{ID: "u3", Name: "c"}},
+		PushTime: 1000,
+		End:      time.UnixMilli(2000),
+		Playlist: []Order{{source: "qq", id: "2", user: auth.User{Name: "d"}, likes: 1}},
+		History: []History{
+			{Order: Order{source: "kuwo", id: "3", user: auth.User{Name: "e"}}, Start: time.UnixMilli(500), Reason: VoteSkipped},
+		},
+	}
+
+	m := storage.NewMemory()
+	ctx := context.Background()
+	if err := m.SaveHouse(ctx, h.snapshot()); err != nil {
+		t.Fatalf("SaveHouse() error = %v", err)
+	}
+	saved, err := m.LoadHouses(ctx)
+	if err != nil || len(saved) != 1 {
+		t.Fatalf("LoadHouses() = %d houses, %v, want 1", len(saved), err)
+	}
+
+	got := &House{}
+	got.restore(saved[0])
+	if got.Owner != h.Owner || !reflect.DeepEqual(got.Moderators, h.Moderators) || got.Mode != h.Mode {
+		t.Errorf("restore() owner %q, moderators %v, mode %v", got.Owner, got.Moderators, got.Mode)
+	}
+	if !reflect.DeepEqual(got.Bans, h.Bans) {
+		t.Errorf("restore() bans = %+v, want %+v", got.Bans, h.Bans)
+	}
+	if !reflect.DeepEqual(got.Mutes, h.Mutes) {
+		t.Errorf("restore() mutes = %+v, want %+v", got.Mutes, h.Mutes)
+	}
+	if !reflect.DeepEqual(got.History, h.History) {
+		t.Errorf("restore() history = %+v, want %+v", got.History, h.History)
+	}
+	if got.Current != h.Current || !got.End.Equal(h.End) || !reflect.DeepEqual(got.Playlist, h.Playlist) {
+		t.Errorf("restore() current %+v, playlist %+v", got.Current, got.Playlist)
+	}
+}
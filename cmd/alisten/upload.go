@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/audio"
+	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/music"
+	"github.com/bihua-university/alisten/internal/music/upload"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	// uploadGCInterval 清理未被引用的上传文件的间隔
+	uploadGCInterval = 10 * time.Minute
+	// uploadGCGrace 上传后至少保留的时间，避免清理刚上传还没有点播的歌曲
+	uploadGCGrace = time.Hour
+)
+
+// uploadKey 当前上传曲库的目录和地址，相同时重新加载配置不会重建曲库
+var uploadKey [2]string
+
+// applyUploadLibrary 按配置启用或停用上传
+func applyUploadLibrary(c base.Configuration) {
+	if c.Upload.Dir == "" {
+		music.SetUploadLibrary(nil)
+		uploadKey = [2]string{}
+		return
+	}
+	key := [2]string{c.Upload.Dir, c.PublicURL}
+	if music.UploadLibrary() != nil && key == uploadKey {
+		return
+	}
+
+	blob, err := upload.NewDirBlob(c.Upload.Dir)
+	if err != nil {
+		slog.Error("open upload dir", "dir", c.Upload.Dir, "error", err)
+		return
+	}
+	lib := upload.New(blob, signingKey("upload"), c.PublicURL)
+	if err := lib.Load(context.Background()); err != nil {
+		slog.Error("load uploads", "dir", c.Upload.Dir, "error", err)
+		return
+	}
+	music.SetUploadLibrary(lib)
+	uploadKey = key
+	slog.Info("upload enabled", "dir", c.Upload.Dir, "tracks", lib.Len())
+}
+
+// uploadedIn 上传的歌曲 id 是否属于房间 houseID
+func uploadedIn(id, houseID string) bool {
+	lib := music.UploadLibrary()
+	if lib == nil {
+		return false
+	}
+	t, err := lib.Get(id)
+	return err == nil && t.House == houseID
+}
+
+// uploadMusicHTTP 上传音频文件并在房间中点播
+//
+// 房间和登录令牌通过 query 传递，在读取文件前检查权限和点歌限制；
+// 文件为 multipart 表单中的 file 字段。
+func uploadMusicHTTP(w http.ResponseWriter, r *http.Request) {
+	lib := music.UploadLibrary()
+	if lib == nil {
+		writeJSON(w, http.StatusNotFound, base.H{"error": "服务器未启用上传"})
+		return
+	}
+
+	q := r.URL.Query()
+	params, _ := json.Marshal(map[string]string{
+		"houseId":  q.Get("houseId"),
+		"password": q.Get("password"),
+		"token":    q.Get("token"),
+	})
+	c := newHTTPContext(w, r, gjson.ParseBytes(params))
+	if c == nil {
+		return
+	}
+	if c.account == nil {
+		writeJSON(w, http.StatusUnauthorized, base.H{"error": "上传需要登录"})
+		return
+	}
+	if !checkPick(c) {
+		return
+	}
+
+	maxSize, formats := base.Current().Upload.Limits()
+	// multipart 的边界和其他字段不会超过 1MB
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, base.H{"error": fmt.Sprintf("文件不能超过 %dMB", maxSize>>20)})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, base.H{"error": "缺少上传的文件"})
+		return
+	}
+	defer file.Close()
+	defer r.MultipartForm.RemoveAll()
+	if header.Size > maxSize {
+		writeJSON(w, http.StatusRequestEntityTooLarge, base.H{"error": fmt.Sprintf("文件不能超过 %dMB", maxSize>>20)})
+		return
+	}
+
+	info, err := audio.Probe(file)
+	switch {
+	case errors.Is(err, audio.ErrUnsupported):
+		writeJSON(w, http.StatusUnsupportedMediaType, base.H{"error": "不支持的音频格式"})
+		return
+	case err != nil:
+		c.Logger().Info("probe upload", "file", header.Filename, "error", err)
+		writeJSON(w, http.StatusBadRequest, base.H{"error": "无法读取音频文件"})
+		return
+	case !slices.Contains(formats, info.Format):
+		writeJSON(w, http.StatusUnsupportedMediaType, base.H{"error": "不允许上传 " + info.Format + " 格式"})
+		return
+	}
+
+	t, err := lib.Add(r.Context(), file, info, header.Filename, c.house.ID, c.User())
+	if err != nil {
+		c.Logger().Error("save upload", "error", err)
+		writeJSON(w, http.StatusInternalServerError, base.H{"error": "保存文件失败"})
+		return
+	}
+	c.Logger().Info("music uploaded", "id", t.ID, "name", t.Name, "size", t.Size, "format", t.Format)
+
+	respondPick(c, doPickMusic(c.house, t.ID, t.Name, music.UploadSource, c.User(), c.GuestID()))
+}
+
+// uploadStreamHTTP 上传音乐的播放地址
+func uploadStreamHTTP(w http.ResponseWriter, r *http.Request) {
+	lib := music.UploadLibrary()
+	if lib == nil {
+		http.NotFound(w, r)
+		return
+	}
+	lib.ServeStream(w, r)
+}
+
+// uploadCoverHTTP 上传音乐的封面地址
+func uploadCoverHTTP(w http.ResponseWriter, r *http.Request) {
+	lib := music.UploadLibrary()
+	if lib == nil {
+		http.NotFound(w, r)
+		return
+	}
+	lib.ServeCover(w, r)
+}
+
+// collectUploads 定期删除没有被任何房间的播放列表、当前播放或播放历史引用的上传文件
+func collectUploads() {
+	ticker := time.NewTicker(uploadGCInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		lib := music.UploadLibrary()
+		if lib == nil {
+			continue
+		}
+		n, err := lib.GC(context.Background(), referencedUploads(), uploadGCGrace)
+		if err != nil {
+			slog.Warn("collect uploads", "error", err)
+		}
+		if n > 0 {
+			slog.Info("collected uploads", "deleted", n, "remaining", lib.Len())
+		}
+	}
+}
+
+// referencedUploads 返回所有房间引用的上传歌曲 ID
+func referencedUploads() map[string]bool {
+	refs := make(map[string]bool)
+	for _, h := range allHouses() {
+		h.lock(func() {
+			if h.Current.source == music.UploadSource {
+				refs[h.Current.id] = true
+			}
+			for _, o := range h.Playlist {
+				if o.source == music.UploadSource {
+					refs[o.id] = true
+				}
+			}
+			for _, v := range h.History {
+				if v.source == music.UploadSource {
+					refs[v.id] = true
+				}
+			}
+		})
+	}
+	return refs
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bihua-university/alisten/internal/task"
+)
+
+// audioExts 本地文件处理器可以提供的音频格式
+var audioExts = map[string]bool{
+	".mp3":  true,
+	".flac": true,
+	".m4a":  true,
+	".aac":  true,
+	".ogg":  true,
+	".opus": true,
+	".wav":  true,
+}
+
+var errNotLocal = errors.New("不是本地文件")
+
+// localHandler 处理 local:get_music 任务，从本地目录提供音频文件
+//
+// 任务中的 url 可以是 baseURL 下的地址、file:// 地址或相对于目录的路径，
+// 文件通过 worker 自身的 HTTP 服务以 baseURL 对外提供。
+type localHandler struct {
+	dir     string
+	baseURL string
+}
+
+// resolve 将任务中的 url 转换为目录下的相对路径，拒绝目录以外的路径
+func (l *localHandler) resolve(raw string) (string, error) {
+	p := raw
+	switch {
+	case strings.HasPrefix(raw, l.baseURL+"/"):
+		p = strings.TrimPrefix(raw, l.baseURL+"/")
+		if u, err := neturl.PathUnescape(p); err == nil {
+			p = u
+		}
+	case strings.HasPrefix(raw, "file://"):
+		p = strings.TrimPrefix(raw, "file://")
+	case strings.Contains(raw, "://"):
+		return "", fmt.Errorf("%w: %s", errNotLocal, raw)
+	}
+
+	p = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(p)), "/")
+	if !filepath.IsLocal(p) {
+		return "", fmt.Errorf("%w: %s", errNotLocal, raw)
+	}
+	if !audioExts[strings.ToLower(path.Ext(p))] {
+		return "", fmt.Errorf("不支持的音频格式: %s", path.Ext(p))
+	}
+	if err := l.checkLink(p); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// checkLink 解析路径中的符号链接，拒绝指向目录以外的文件
+//
+// filepath.IsLocal 只检查路径本身，目录中的符号链接仍可能指向任意文件。
+func (l *localHandler) checkLink(rel string) error {
+	root, err := filepath.EvalSymlinks(l.dir)
+	if err != nil {
+		return fmt.Errorf("本地目录不可用: %w", err)
+	}
+	target, err := filepath.EvalSymlinks(filepath.Join(l.dir, filepath.FromSlash(rel)))
+	if err != nil {
+		return fmt.Errorf("文件不存在: %s", rel)
+	}
+	if r, err := filepath.Rel(root, target); err != nil || !filepath.IsLocal(r) {
+		return fmt.Errorf("%w: %s", errNotLocal, rel)
+	}
+	return nil
+}
+
+func (l *localHandler) Handle(ctx context.Context, t *task.Task, report ReportFunc) (any, error) {
+	rel, err := l.resolve(t.Data["url"])
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(l.dir, filepath.FromSlash(rel))
+	if st, err := os.Stat(file); err != nil || !st.Mode().IsRegular() {
+		return nil, fmt.Errorf("文件不存在: %s", rel)
+	}
+
+	info, err := probe(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	if info.Name == "" {
+		info.Name = strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+	}
+
+	u, err := neturl.JoinPath(l.baseURL, strings.Split(rel, "/")...)
+	if err != nil {
+		return nil, fmt.Errorf("生成文件地址失败: %w", err)
+	}
+	report(task.StageDone, 100)
+	return map[string]any{
+		"type":     "music",
+		"url":      u,
+		"webUrl":   u,
+		"duration": info.Duration,
+		"artist":   info.Artist,
+		"name":     info.Name,
+		"al":       map[string]string{"name": info.Album},
+	}, nil
+}
+
+// ServeHTTP 提供目录下的音频文件，支持 Range 请求，不列出目录
+func (l *localHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rel, err := l.resolve(r.URL.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filepath.Join(l.dir, filepath.FromSlash(rel)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil || !st.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, st.Name(), st.ModTime(), f)
+}
+
+// audioInfo ffprobe 读取的音频信息
+type audioInfo struct {
+	Duration int64 // 毫秒
+	Name     string
+	Artist   string
+	Album    string
+}
+
+// probe 使用 ffprobe 读取音频时长和标签
+func probe(ctx context.Context, file string) (*audioInfo, error) {
+	out, err := exec.CommandContext(ctx, "ffprobe",
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_format",
+		file,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("读取音频信息失败: %w", err)
+	}
+
+	var res struct {
+		Format struct {
+			Duration string            `json:"duration"`
+			Tags     map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &res); err != nil {
+		return nil, fmt.Errorf("解析音频信息失败: %w", err)
+	}
+	seconds, err := strconv.ParseFloat(res.Format.Duration, 64)
+	if err != nil || seconds <= 0 {
+		return nil, fmt.Errorf("无法获取音频时长")
+	}
+
+	// 不同格式的标签名大小写不同
+	tag := func(key string) string {
+		for k, v := range res.Format.Tags {
+			if strings.EqualFold(k, key) {
+				return v
+			}
+		}
+		return ""
+	}
+	return &audioInfo{
+		Duration: int64(seconds * 1000),
+		Name:     tag("title"),
+		Artist:   tag("artist"),
+		Album:    tag("album"),
+	}, nil
+}
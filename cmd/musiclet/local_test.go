@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalResolve(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "music")
+	outside := filepath.Join(root, "outside")
+	for _, d := range []string{filepath.Join(dir, "sub"), outside} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(dir, "a.mp3"), filepath.Join(dir, "sub", "b c.flac"), filepath.Join(outside, "secret.mp3")} {
+		if err := os.WriteFile(f, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"inner.mp3": filepath.Join(dir, "a.mp3"),
+		"evil.mp3":  filepath.Join(outside, "secret.mp3"),
+		"evildir":   outside,
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Skipf("symlink: %v", err)
+		}
+	}
+
+	l := &localHandler{dir: dir, baseURL: "http://127.0.0.1:8081"}
+	tests := []struct {
+		raw     string
+		want    string
+		notLoc  bool // 期望 errNotLocal
+		wantErr bool
+	}{
+		{raw: "a.mp3", want: "a.mp3"},
+		{raw: "http://127.0.0.1:8081/sub/b%20c.flac", want: "sub/b c.flac"},
+		{raw: "file://sub/b c.flac", want: "sub/b c.flac"},
+		{raw: "inner.mp3", want: "inner.mp3"},
+		// ../ 和绝对路径按目录内的路径处理，不会访问目录以外的文件
+		{raw: "../outside/secret.mp3", wantErr: true},
+		{raw: "sub/../../outside/secret.mp3", wantErr: true},
+		{raw: filepath.Join(outside, "secret.mp3"), wantErr: true},
+		{raw: "file://" + filepath.Join(outside, "secret.mp3"), wantErr: true},
+		// 指向目录以外的符号链接
+		{raw: "evil.mp3", notLoc: true},
+		{raw: "evildir/secret.mp3", notLoc: true},
+		{raw: "https://example.com/a.mp3", notLoc: true},
+		{raw: "a.txt", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := l.resolve(tt.raw)
+		switch {
+		case tt.notLoc:
+			if !errors.Is(err, errNotLocal) {
+				t.Errorf("resolve(%q) = %q, %v, want errNotLocal", tt.raw, got, err)
+			}
+		case tt.wantErr:
+			if err == nil {
+				t.Errorf("resolve(%q) = %q, want error", tt.raw, got)
+			}
+		case err != nil || got != tt.want:
+			t.Errorf("resolve(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// musiclet 是 Go 实现的 musiclet worker，从 alisten 服务器领取任务并执行
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/task"
+)
+
+// Config musiclet 配置
+type Config struct {
+	ServerURL   string `json:"server_url"`
+	Token       string `json:"token"`
+	ID          string `json:"id"`          // worker ID，默认为 主机名-进程号
+	Concurrency int    `json:"concurrency"` // 同时执行的最大任务数，默认为 4
+	Shutdown    int    `json:"shutdown"`    // 关闭时等待正在执行的任务的秒数，默认为 30
+	Debug       bool   `json:"debug"`
+	Local       *struct {
+		Dir     string `json:"dir"`      // 音频文件目录
+		Listen  string `json:"listen"`   // 提供音频文件的 HTTP 监听地址
+		BaseURL string `json:"base_url"` // 音频文件对外的地址前缀
+	} `json:"local"` // 本地文件处理器，为空表示不启用
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	c := &Config{Concurrency: 4, Shutdown: 30}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	if c.ServerURL == "" {
+		return nil, errors.New("缺少 server_url")
+	}
+	c.ServerURL = strings.TrimSuffix(c.ServerURL, "/")
+	if l := c.Local; l != nil {
+		if l.Dir == "" || l.Listen == "" || l.BaseURL == "" {
+			return nil, errors.New("local 需要 dir、listen 和 base_url")
+		}
+		l.BaseURL = strings.TrimSuffix(l.BaseURL, "/")
+	}
+	return c, nil
+}
+
+func main() {
+	configPath := flag.String("config", "config.json", "配置文件路径")
+	flag.Parse()
+
+	c, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	level := slog.LevelInfo
+	if c.Debug {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	client := task.NewClient(c.ServerURL, c.Token)
+	if c.ID != "" {
+		client.ID = c.ID
+	}
+	w := NewWorker(client, c.Concurrency)
+
+	var srv *http.Server
+	if l := c.Local; l != nil {
+		h := &localHandler{dir: l.Dir, baseURL: l.BaseURL}
+		w.Handle("local:get_music", h)
+
+		srv = &http.Server{Addr: l.Listen, Handler: h}
+		go func() {
+			slog.Info("serving local files", "dir", l.Dir, "addr", l.Listen, "base_url", l.BaseURL)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("file server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+	if len(w.Types()) == 0 {
+		fmt.Fprintln(os.Stderr, "没有启用任何任务处理器")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	w.Run(ctx, time.Duration(c.Shutdown)*time.Second)
+
+	if srv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/task"
+)
+
+const (
+	// heartbeatInterval 心跳间隔，需要小于服务器的任务租约
+	heartbeatInterval = 10 * time.Second
+	// pollRetryDelay 领取任务失败后等待重试的时间
+	pollRetryDelay = 5 * time.Second
+)
+
+// ReportFunc 报告任务进度，percent 为 0 到 100
+type ReportFunc func(stage string, percent float64)
+
+// Handler 执行一种类型的任务，返回值序列化为 JSON 作为任务结果
+//
+// ctx 在服务器取消任务或 worker 关闭超时时取消。
+type Handler interface {
+	Handle(ctx context.Context, t *task.Task, report ReportFunc) (any, error)
+}
+
+// HandlerFunc 将函数适配为 Handler
+type HandlerFunc func(ctx context.Context, t *task.Task, report ReportFunc) (any, error)
+
+func (f HandlerFunc) Handle(ctx context.Context, t *task.Task, report ReportFunc) (any, error) {
+	return f(ctx, t, report)
+}
+
+// running 正在执行的任务
+type running struct {
+	attempt int
+	cancel  context.CancelFunc
+}
+
+// Worker 从服务器领取任务，按任务类型交给注册的 Handler 执行
+type Worker struct {
+	client      *task.Client
+	handlers    map[string]Handler
+	concurrency int
+
+	mu      sync.Mutex
+	running map[string]*running
+	wg      sync.WaitGroup
+	// base 任务的父 context，与领取任务的 context 分开，关闭时让正在执行的任务有机会完成
+	base   context.Context
+	cancel context.CancelFunc
+}
+
+// NewWorker 创建 worker，concurrency 为同时执行的最大任务数
+func NewWorker(client *task.Client, concurrency int) *Worker {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Worker{
+		client:      client,
+		handlers:    make(map[string]Handler),
+		concurrency: concurrency,
+		running:     make(map[string]*running),
+		base:        ctx,
+		cancel:      cancel,
+	}
+}
+
+// Handle 注册任务类型的 Handler，需要在 Run 之前调用
+func (w *Worker) Handle(taskType string, h Handler) {
+	w.handlers[taskType] = h
+}
+
+// Types 返回已注册的任务类型
+func (w *Worker) Types() []string {
+	return slices.Sorted(maps.Keys(w.handlers))
+}
+
+// Run 领取并执行任务，直到 ctx 取消
+//
+// ctx 取消后停止领取任务并等待正在执行的任务完成，
+// 超过 grace 仍未完成的任务被取消，不提交结果，由服务器在租约过期后重新分发。
+func (w *Worker) Run(ctx context.Context, grace time.Duration) {
+	w.client.Types = w.Types()
+	w.client.Lease = true
+	slog.Info("worker started", "id", w.client.ID, "types", w.client.Types, "concurrency", w.concurrency)
+
+	stop := make(chan struct{})
+	go w.heartbeat(stop)
+
+	slots := make(chan struct{}, w.concurrency)
+	for ctx.Err() == nil {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		t, err := w.client.GetTask(ctx)
+		if err != nil || t == nil {
+			<-slots
+			if err != nil && ctx.Err() == nil {
+				slog.Warn("poll task failed", "error", err)
+				select {
+				case <-time.After(pollRetryDelay):
+				case <-ctx.Done():
+				}
+			}
+			continue
+		}
+
+		w.start(t, func() { <-slots })
+	}
+
+	slog.Info("worker stopping, waiting for running tasks", "running", w.runningCount())
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(grace):
+		slog.Warn("shutdown timed out, cancelling running tasks", "running", w.runningCount())
+		w.cancel()
+		<-done
+	}
+	close(stop)
+	slog.Info("worker stopped")
+}
+
+// start 在新的 goroutine 中执行任务，结束时调用 release
+func (w *Worker) start(t *task.Task, release func()) {
+	ctx, cancel := context.WithCancel(w.base)
+	w.mu.Lock()
+	w.running[t.ID] = &running{attempt: t.Attempt, cancel: cancel}
+	w.mu.Unlock()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer release()
+		defer func() {
+			w.mu.Lock()
+			delete(w.running, t.ID)
+			w.mu.Unlock()
+			cancel()
+		}()
+
+		log := slog.With(base.LogTask, t.ID, "type", t.Type, "attempt", t.Attempt)
+		log.Info("task started")
+		start := time.Now()
+		result := w.execute(ctx, t)
+		if ctx.Err() != nil {
+			// 任务被服务器取消或 worker 关闭，服务器不再需要结果
+			log.Info("task cancelled", "elapsed", time.Since(start))
+			return
+		}
+		if err := w.client.SubmitResult(result); err != nil {
+			log.Warn("submit result failed", "error", err)
+			return
+		}
+		log.Info("task finished", "success", result.Success, "error", result.Error, "elapsed", time.Since(start))
+	}()
+}
+
+// execute 调用 Handler，将返回值或错误转换为任务结果
+func (w *Worker) execute(ctx context.Context, t *task.Task) (result *task.Result) {
+	defer func() {
+		if err := recover(); err != nil {
+			slog.Error("panic", base.LogTask, t.ID, "error", err, "stack", string(debug.Stack()))
+			result = task.NewResultWithError(t.ID, fmt.Sprintf("panic: %v", err))
+		}
+	}()
+
+	h := w.handlers[t.Type]
+	if h == nil {
+		return task.NewResultWithError(t.ID, "不支持的任务类型: "+t.Type)
+	}
+
+	v, err := h.Handle(ctx, t, w.reporter(ctx, t))
+	if err != nil {
+		return task.NewResultWithError(t.ID, err.Error())
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return task.NewResultWithError(t.ID, "序列化结果失败: "+err.Error())
+	}
+	result = task.NewResult(t.ID, true)
+	result.Result = data
+	return result
+}
+
+// reporter 返回向服务器报告任务进度的函数，服务器要求取消时取消任务
+func (w *Worker) reporter(ctx context.Context, t *task.Task) ReportFunc {
+	return func(stage string, percent float64) {
+		cancelled, err := w.client.Progress(ctx, &task.Progress{
+			ID:      t.ID,
+			Attempt: t.Attempt,
+			Stage:   stage,
+			Percent: percent,
+		})
+		if err != nil {
+			slog.Debug("report progress failed", base.LogTask, t.ID, "error", err)
+			return
+		}
+		if cancelled {
+			w.cancelTask(t.ID)
+		}
+	}
+}
+
+// heartbeat 定期为正在执行的任务续约，并取消服务器要求取消的任务
+func (w *Worker) heartbeat(stop <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		var beats []task.Heartbeat
+		w.mu.Lock()
+		for id, r := range w.running {
+			beats = append(beats, task.Heartbeat{ID: id, Attempt: r.attempt})
+		}
+		w.mu.Unlock()
+		if len(beats) == 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), heartbeatInterval)
+		cancelled, err := w.client.Heartbeat(ctx, beats)
+		cancel()
+		if err != nil {
+			slog.Warn("heartbeat failed", "error", err)
+			continue
+		}
+		for _, id := range cancelled {
+			slog.Info("task cancelled by server", base.LogTask, id)
+			w.cancelTask(id)
+		}
+	}
+}
+
+func (w *Worker) cancelTask(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if r := w.running[id]; r != nil {
+		r.cancel()
+	}
+}
+
+func (w *Worker) runningCount() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.running)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/task"
+)
+
+const testTaskType = "test:run"
+
+// newTestServer 启动任务服务器，返回服务器和连接到它的客户端
+func newTestServer(t *testing.T) (*task.Server, *task.Client) {
+	t.Helper()
+	s := task.NewServer("secret")
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tasks/poll", s.PollTaskHandler)
+	mux.HandleFunc("POST /tasks/result", s.SubmitResultHandler)
+	mux.HandleFunc("POST /tasks/heartbeat", s.HeartbeatHandler)
+	mux.HandleFunc("POST /tasks/progress", s.ProgressHandler)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		s.Close()
+		ts.Close()
+	})
+
+	c := task.NewClient(ts.URL, "secret")
+	c.PollTimeout = time.Second
+	return s, c
+}
+
+// newTestTask 等待 worker 开始轮询后创建任务
+func newTestTask(t *testing.T, s *task.Server) *task.Task {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tk, err := s.NewTask(testTaskType, nil)
+		if err == nil {
+			return tk
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("NewTask() error = %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// runWorker 在后台运行 worker，返回停止函数，停止函数等待 Run 返回
+func runWorker(w *Worker, grace time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx, grace)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestWorkerConcurrency(t *testing.T) {
+	s, c := newTestServer(t)
+	const limit, total = 2, 5
+
+	var active, peak atomic.Int32
+	started := make(chan struct{}, total)
+	release := make(chan struct{})
+	w := NewWorker(c, limit)
+	w.Handle(testTaskType, HandlerFunc(func(ctx context.Context, t *task.Task, report ReportFunc) (any, error) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		started <- struct{}{}
+		<-release
+		return t.ID, nil
+	}))
+	stop := runWorker(w, time.Second)
+	defer stop()
+
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for range total {
+		tk := newTestTask(t, s)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r := s.Call(tk, 10*time.Second); r != nil && r.Success {
+				succeeded.Add(1)
+			}
+		}()
+	}
+
+	for range limit {
+		waitFor(t, started, "task start")
+	}
+	// 达到并发上限后不应再领取任务
+	select {
+	case <-started:
+		t.Fatalf("started more than %d tasks", limit)
+	case <-time.After(200 * time.Millisecond):
+	}
+	close(release)
+	wg.Wait()
+
+	if got := peak.Load(); got != limit {
+		t.Errorf("peak running = %d, want %d", got, limit)
+	}
+	if got := succeeded.Load(); got != total {
+		t.Errorf("succeeded = %d, want %d", got, total)
+	}
+}
+
+func TestWorkerCancel(t *testing.T) {
+	s, c := newTestServer(t)
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	w := NewWorker(c, 1)
+	w.Handle(testTaskType, HandlerFunc(func(ctx context.Context, t *task.Task, report ReportFunc) (any, error) {
+		close(started)
+		for ctx.Err() == nil {
+			report("running", 50)
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(cancelled)
+		return nil, ctx.Err()
+	}))
+	stop := runWorker(w, time.Second)
+	defer stop()
+
+	tk := newTestTask(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan *task.Result, 1)
+	go func() { result <- s.CallContext(ctx, tk) }()
+
+	waitFor(t, started, "task start")
+	// 调用方放弃等待后，worker 报告进度时得知任务已取消
+	cancel()
+	waitFor(t, cancelled, "task cancel")
+	if r := <-result; r != nil {
+		t.Errorf("CallContext() = %+v, want nil", r)
+	}
+}
+
+func TestWorkerShutdown(t *testing.T) {
+	tests := []struct {
+		name      string
+		grace     time.Duration
+		wantDone  bool // 任务在 grace 内完成并提交结果
+		handlerIn time.Duration
+	}{
+		{name: "wait", grace: 5 * time.Second, wantDone: true, handlerIn: 200 * time.Millisecond},
+		{name: "timeout", grace: 100 * time.Millisecond, handlerIn: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newTestServer(t)
+
+			started := make(chan struct{})
+			var interrupted atomic.Bool
+			w := NewWorker(c, 1)
+			w.Handle(testTaskType, HandlerFunc(func(ctx context.Context, t *task.Task, report ReportFunc) (any, error) {
+				close(started)
+				select {
+				case <-time.After(tt.handlerIn):
+					return "ok", nil
+				case <-ctx.Done():
+					interrupted.Store(true)
+					return nil, ctx.Err()
+				}
+			}))
+			stop := runWorker(w, tt.grace)
+
+			tk := newTestTask(t, s)
+			result := make(chan *task.Result, 1)
+			go func() { result <- s.Call(tk, 2*time.Second) }()
+			waitFor(t, started, "task start")
+
+			// 停止领取任务，Run 在正在执行的任务结束或 grace 超时后返回
+			stop()
+			if got := w.runningCount(); got != 0 {
+				t.Errorf("running after Run returned = %d, want 0", got)
+			}
+			if interrupted.Load() == tt.wantDone {
+				t.Errorf("handler interrupted = %v, want %v", interrupted.Load(), !tt.wantDone)
+			}
+
+			r := <-result
+			if tt.wantDone && (r == nil || !r.Success) {
+				t.Errorf("Call() = %+v, want success", r)
+			}
+			if !tt.wantDone && r != nil {
+				t.Errorf("Call() = %+v, want nil (no result submitted)", r)
+			}
+		})
+	}
+}
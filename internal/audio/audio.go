@@ -0,0 +1,118 @@
+// Package audio 读取音频文件的标签、封面和时长，目前支持 MP3 和 FLAC
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// 支持的音频格式
+const (
+	MP3  = "mp3"
+	FLAC = "flac"
+)
+
+var (
+	// ErrUnsupported 不支持的音频格式
+	ErrUnsupported = errors.New("unsupported audio format")
+	// ErrInvalid 文件损坏或无法读取时长
+	ErrInvalid = errors.New("invalid audio file")
+)
+
+// Info 音频文件的信息
+type Info struct {
+	Format   string // MP3 或 FLAC
+	Title    string
+	Artist   string
+	Album    string
+	Duration int64    // 毫秒
+	Picture  *Picture // 内嵌封面，没有时为 nil
+}
+
+// Picture 内嵌封面
+type Picture struct {
+	MIMEType string
+	Data     []byte
+}
+
+// MIMEType 返回音频格式的 MIME 类型
+func MIMEType(format string) string {
+	switch format {
+	case MP3:
+		return "audio/mpeg"
+	case FLAC:
+		return "audio/flac"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Probe 读取音频文件的格式、时长和标签，r 需要位于文件开头
+//
+// 没有标签的文件只返回格式和时长，不能识别的格式返回 ErrUnsupported。
+func Probe(r io.ReadSeeker) (*Info, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	info := &Info{}
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	switch {
+	case string(head) == "fLaC":
+		info.Format = FLAC
+		info.Duration, err = flacDuration(r)
+	case string(head[:3]) == "ID3" || isFrameSync(head):
+		info.Format = MP3
+		info.Duration, err = mp3Duration(r, size)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	// 标签损坏不影响播放，只使用能读到的信息
+	if m, err := tag.ReadFrom(r); err == nil {
+		info.Title = strings.TrimSpace(m.Title())
+		info.Artist = strings.TrimSpace(m.Artist())
+		info.Album = strings.TrimSpace(m.Album())
+		if p := m.Picture(); p != nil && len(p.Data) > 0 {
+			info.Picture = &Picture{MIMEType: p.MIMEType, Data: p.Data}
+		}
+	}
+	return info, nil
+}
+
+// flacDuration 从 STREAMINFO 读取时长，r 位于 "fLaC" 之后
+func flacDuration(r io.Reader) (int64, error) {
+	// 第一个元数据块必须是 STREAMINFO：4 字节块头和 34 字节内容
+	b := make([]byte, 4+34)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if b[0]&0x7f != 0 {
+		return 0, fmt.Errorf("%w: missing STREAMINFO", ErrInvalid)
+	}
+	s := b[4:]
+	// 采样率 20 位，声道数 3 位，位深 5 位，总采样数 36 位
+	rate := int64(s[10])<<12 | int64(s[11])<<4 | int64(s[12])>>4
+	samples := int64(s[13]&0x0f)<<32 | int64(s[14])<<24 | int64(s[15])<<16 | int64(s[16])<<8 | int64(s[17])
+	if rate == 0 || samples == 0 {
+		return 0, fmt.Errorf("%w: unknown duration", ErrInvalid)
+	}
+	return samples * 1000 / rate, nil
+}
@@ -0,0 +1,70 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// cbrFrames 生成 n 个 MPEG-1 Layer III 128kbps 44.1kHz 立体声帧，每帧 417 字节
+func cbrFrames(n int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	return bytes.Repeat(frame, n)
+}
+
+func TestProbeMP3(t *testing.T) {
+	// ID3v2 标签后接 100 帧 CBR 音频
+	id3 := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 10}
+	id3 = append(id3, make([]byte, 10)...)
+	data := append(id3, cbrFrames(100)...)
+	info, err := Probe(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Probe(cbr) error = %v", err)
+	}
+	if info.Format != MP3 || info.Duration != 100*417*8/128 {
+		t.Errorf("Probe(cbr) = %s %dms, want mp3 %dms", info.Format, info.Duration, 100*417*8/128)
+	}
+
+	// 第一帧带有 Xing 头，记录 1000 帧
+	data = cbrFrames(10)
+	xing := data[4+32:]
+	copy(xing, "Xing")
+	binary.BigEndian.PutUint32(xing[4:], 1)
+	binary.BigEndian.PutUint32(xing[8:], 1000)
+	info, err = Probe(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Probe(xing) error = %v", err)
+	}
+	if want := int64(1000 * 1152 * 1000 / 44100); info.Duration != want {
+		t.Errorf("Probe(xing) duration = %d, want %d", info.Duration, want)
+	}
+}
+
+func TestProbeFLAC(t *testing.T) {
+	// STREAMINFO: 44.1kHz，2 声道，16 位，441000 个采样
+	info := make([]byte, 34)
+	rate, samples := uint64(44100), uint64(441000)
+	packed := rate<<44 | 1<<41 | 15<<36 | samples
+	binary.BigEndian.PutUint64(info[10:], packed)
+	data := append([]byte("fLaC"), 0x80, 0, 0, 34)
+	data = append(data, info...)
+
+	got, err := Probe(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Probe(flac) error = %v", err)
+	}
+	if got.Format != FLAC || got.Duration != 10000 {
+		t.Errorf("Probe(flac) = %s %dms, want flac 10000ms", got.Format, got.Duration)
+	}
+}
+
+func TestProbeUnsupported(t *testing.T) {
+	if _, err := Probe(bytes.NewReader([]byte("RIFF....WAVE"))); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Probe(wav) error = %v, want ErrUnsupported", err)
+	}
+	if _, err := Probe(bytes.NewReader([]byte{0xff, 0xfb, 0x90})); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Probe(truncated) error = %v, want ErrInvalid", err)
+	}
+}
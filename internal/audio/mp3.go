@@ -0,0 +1,171 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// mp3SearchLimit 查找第一个 MPEG 帧时最多读取的字节数
+const mp3SearchLimit = 64 << 10
+
+// 比特率表（kbps），按 MPEG 版本和层排列，下标为帧头中的比特率索引
+var (
+	bitratesV1L1 = [15]int64{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448}
+	bitratesV1L2 = [15]int64{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384}
+	bitratesV1L3 = [15]int64{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}
+	bitratesV2L1 = [15]int64{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256}
+	bitratesV2L3 = [15]int64{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160}
+)
+
+// frameHeader MPEG 音频帧头
+type frameHeader struct {
+	v1      bool  // MPEG-1，否则为 MPEG-2 或 MPEG-2.5
+	bitrate int64 // kbps
+	rate    int64 // 采样率
+	samples int64 // 每帧采样数
+	size    int64 // 帧长度
+	mono    bool
+}
+
+func isFrameSync(b []byte) bool {
+	_, ok := parseFrameHeader(b)
+	return ok
+}
+
+func parseFrameHeader(b []byte) (frameHeader, bool) {
+	var h frameHeader
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return h, false
+	}
+	version := b[1] >> 3 & 3 // 0: MPEG-2.5, 2: MPEG-2, 3: MPEG-1
+	layer := b[1] >> 1 & 3   // 1: Layer III, 2: Layer II, 3: Layer I
+	bitrateIndex := b[2] >> 4
+	rateIndex := b[2] >> 2 & 3
+	if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		// 保留值，不支持自由比特率
+		return h, false
+	}
+
+	h.v1 = version == 3
+	h.rate = [3]int64{44100, 48000, 32000}[rateIndex]
+	switch version {
+	case 2:
+		h.rate /= 2
+	case 0:
+		h.rate /= 4
+	}
+	switch {
+	case h.v1 && layer == 3:
+		h.bitrate = bitratesV1L1[bitrateIndex]
+	case h.v1 && layer == 2:
+		h.bitrate = bitratesV1L2[bitrateIndex]
+	case h.v1:
+		h.bitrate = bitratesV1L3[bitrateIndex]
+	case layer == 3:
+		h.bitrate = bitratesV2L1[bitrateIndex]
+	default:
+		h.bitrate = bitratesV2L3[bitrateIndex]
+	}
+
+	padding := int64(b[2] >> 1 & 1)
+	switch {
+	case layer == 3:
+		h.samples = 384
+		h.size = (12*h.bitrate*1000/h.rate + padding) * 4
+	case layer == 2 || h.v1:
+		h.samples = 1152
+		h.size = 144*h.bitrate*1000/h.rate + padding
+	default:
+		h.samples = 576
+		h.size = 72*h.bitrate*1000/h.rate + padding
+	}
+	h.mono = b[3]>>6 == 3
+	return h, true
+}
+
+// mp3Duration 计算 MP3 的时长
+//
+// VBR 文件读取第一帧中的 Xing/Info 或 VBRI 头记录的帧数，
+// 没有这些头时按第一帧的比特率和音频数据的长度估算。
+func mp3Duration(r io.ReadSeeker, size int64) (int64, error) {
+	start, end := int64(0), size
+
+	head := make([]byte, 10)
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if string(head[:3]) == "ID3" {
+		// ID3v2 标签长度为 syncsafe 整数，每字节 7 位
+		start = 10 + (int64(head[6])<<21 | int64(head[7])<<14 | int64(head[8])<<7 | int64(head[9]))
+		if head[5]&0x10 != 0 {
+			start += 10 // 标签尾
+		}
+	}
+	if size >= 128 {
+		tail := make([]byte, 3)
+		if _, err := r.Seek(size-128, io.SeekStart); err == nil {
+			if _, err := io.ReadFull(r, tail); err == nil && string(tail) == "TAG" {
+				end -= 128 // ID3v1 标签
+			}
+		}
+	}
+	if start >= end {
+		return 0, fmt.Errorf("%w: no audio data", ErrInvalid)
+	}
+
+	buf := make([]byte, min(end-start, mp3SearchLimit))
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		h, ok := parseFrameHeader(buf[i:])
+		if !ok {
+			continue
+		}
+		// 下一帧也是合法的帧头才认为找到了帧，避免数据中偶然出现的同步字
+		if next := int64(i) + h.size; next+4 <= int64(len(buf)) {
+			if _, ok := parseFrameHeader(buf[next:]); !ok {
+				continue
+			}
+		}
+		if frames := vbrFrames(buf[i:], h); frames > 0 {
+			return frames * h.samples * 1000 / h.rate, nil
+		}
+		return (end - start - int64(i)) * 8 / h.bitrate, nil
+	}
+	return 0, fmt.Errorf("%w: no MPEG frame found", ErrInvalid)
+}
+
+// vbrFrames 返回第一帧中 Xing/Info 或 VBRI 头记录的帧数，没有时返回 0
+func vbrFrames(frame []byte, h frameHeader) int64 {
+	// Xing 头位于边信息之后
+	side := 32
+	switch {
+	case h.v1 && h.mono:
+		side = 17
+	case !h.v1 && h.mono:
+		side = 9
+	case !h.v1:
+		side = 17
+	}
+	if x := frame[min(4+side, len(frame)):]; len(x) >= 12 && (string(x[:4]) == "Xing" || string(x[:4]) == "Info") {
+		if binary.BigEndian.Uint32(x[4:8])&1 != 0 {
+			return int64(binary.BigEndian.Uint32(x[8:12]))
+		}
+	}
+	// VBRI 头固定位于帧头之后 32 字节
+	if v := frame[min(4+32, len(frame)):]; len(v) >= 18 && string(v[:4]) == "VBRI" {
+		return int64(binary.BigEndian.Uint32(v[14:18]))
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrAccountExists    = errors.New("用户名已被注册")
+	ErrAccountNotFound  = errors.New("账号不存在")
+	ErrInvalidPassword  = errors.New("用户名或密码错误")
+	ErrInvalidAccount   = errors.New("用户名或密码格式不正确")
+	ErrInvalidSession   = errors.New("登录已失效，请重新登录")
+	ErrSessionExpired   = fmt.Errorf("%w: session expired", ErrInvalidSession)
+	errPasswordTooShort = fmt.Errorf("%w: 密码至少 %d 位", ErrInvalidAccount, minPasswordLen)
+)
+
+const (
+	minPasswordLen = 6
+	maxNameLen     = 32
+)
+
+// Account 注册用户
+type Account struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"` // salted md5 of email
+	PasswordHash []byte    `json:"-"`
+	CreatedAt    time.Time `json:"createTime"`
+}
+
+// User 返回账号对应的用户信息
+func (a *Account) User() User {
+	return User{ID: a.ID, Name: a.Name, Email: a.Email}
+}
+
+// AccountStore 账号存储
+type AccountStore interface {
+	// CreateAccount 创建账号，用户名已存在时返回 ErrAccountExists
+	CreateAccount(ctx context.Context, a *Account) error
+	// GetAccount 根据 ID 获取账号，不存在时返回 ErrAccountNotFound
+	GetAccount(ctx context.Context, id string) (*Account, error)
+	// GetAccountByName 根据用户名获取账号，不存在时返回 ErrAccountNotFound
+	GetAccountByName(ctx context.Context, name string) (*Account, error)
+}
+
+// Accounts 账号注册、登录和会话校验
+type Accounts struct {
+	store    AccountStore
+	sessions *SessionSigner
+}
+
+// NewAccounts 创建账号服务，secret 用于签名会话令牌
+func NewAccounts(store AccountStore, secret []byte) *Accounts {
+	return &Accounts{
+		store:    store,
+		sessions: NewSessionSigner(secret, SessionTTL),
+	}
+}
+
+// Register 注册新账号并返回登录令牌
+func (s *Accounts) Register(ctx context.Context, name, email, password string) (*Account, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLen {
+		return nil, "", fmt.Errorf("%w: 用户名长度应为 1-%d 个字符", ErrInvalidAccount, maxNameLen)
+	}
+	if len(password) < minPasswordLen {
+		return nil, "", errPasswordTooShort
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		// 密码超过 72 字节
+		return nil, "", fmt.Errorf("%w: %w", ErrInvalidAccount, err)
+	}
+	a := &Account{
+		ID:           uuid.New().String(),
+		Name:         name,
+		PasswordHash: hash,
+		CreatedAt:    time.Now(),
+	}
+	if email != "" {
+		a.Email = EmailToMD5(email)
+	}
+	if err := s.store.CreateAccount(ctx, a); err != nil {
+		return nil, "", err
+	}
+	return a, s.sessions.Sign(a.ID), nil
+}
+
+// Login 校验用户名和密码并返回登录令牌
+func (s *Accounts) Login(ctx context.Context, name, password string) (*Account, string, error) {
+	a, err := s.store.GetAccountByName(ctx, strings.TrimSpace(name))
+	if errors.Is(err, ErrAccountNotFound) {
+		return nil, "", ErrInvalidPassword
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if bcrypt.CompareHashAndPassword(a.PasswordHash, []byte(password)) != nil {
+		return nil, "", ErrInvalidPassword
+	}
+	return a, s.sessions.Sign(a.ID), nil
+}
+
+// Resolve 将登录令牌解析为已验证的用户
+func (s *Accounts) Resolve(ctx context.Context, token string) (User, error) {
+	id, err := s.sessions.Verify(token)
+	if err != nil {
+		return User{}, err
+	}
+	a, err := s.store.GetAccount(ctx, id)
+	if errors.Is(err, ErrAccountNotFound) {
+		return User{}, ErrInvalidSession
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return a.User(), nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// SessionTTL 登录令牌的有效期
+const SessionTTL = 30 * 24 * time.Hour
+
+// SessionSigner 签发和校验 HMAC-SHA256 签名的登录令牌
+//
+// 令牌格式为 base64url(payload).base64url(signature)，payload 为 JSON 编码的 sessionClaims。
+type SessionSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+type sessionClaims struct {
+	AccountID string `json:"uid"`
+	Expire    int64  `json:"exp"` // unix 秒
+}
+
+// NewSessionSigner 创建令牌签名器
+func NewSessionSigner(secret []byte, ttl time.Duration) *SessionSigner {
+	return &SessionSigner{secret: secret, ttl: ttl}
+}
+
+// Sign 为账号签发登录令牌
+func (s *SessionSigner) Sign(accountID string) string {
+	payload, _ := json.Marshal(sessionClaims{
+		AccountID: accountID,
+		Expire:    time.Now().Add(s.ttl).Unix(),
+	})
+	p := base64.RawURLEncoding.EncodeToString(payload)
+	return p + "." + base64.RawURLEncoding.EncodeToString(s.mac(p))
+}
+
+// Verify 校验登录令牌并返回账号 ID
+func (s *SessionSigner) Verify(token string) (string, error) {
+	p, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidSession
+	}
+	b, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(b, s.mac(p)) {
+		return "", ErrInvalidSession
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return "", ErrInvalidSession
+	}
+	var c sessionClaims
+	if err := json.Unmarshal(payload, &c); err != nil || c.AccountID == "" {
+		return "", ErrInvalidSession
+	}
+	if time.Now().Unix() > c.Expire {
+		return "", ErrSessionExpired
+	}
+	return c.AccountID, nil
+}
+
+func (s *SessionSigner) mac(payload string) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionSignVerify(t *testing.T) {
+	s := NewSessionSigner([]byte("secret"), time.Hour)
+	token := s.Sign("account-id")
+
+	id, err := s.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if id != "account-id" {
+		t.Errorf("Verify() = %s, want account-id", id)
+	}
+}
+
+func TestSessionVerifyInvalid(t *testing.T) {
+	s := NewSessionSigner([]byte("secret"), time.Hour)
+	other := NewSessionSigner([]byte("other"), time.Hour)
+	token := s.Sign("account-id")
+
+	testCases := []string{
+		"",
+		"no-dot",
+		token + "x",
+		other.Sign("account-id"),
+	}
+	for _, tc := range testCases {
+		if _, err := s.Verify(tc); !errors.Is(err, ErrInvalidSession) {
+			t.Errorf("Verify(%q) error = %v, want ErrInvalidSession", tc, err)
+		}
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	s := NewSessionSigner([]byte("secret"), -time.Minute)
+	if _, err := s.Verify(s.Sign("account-id")); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Verify() error = %v, want ErrSessionExpired", err)
+	}
+}
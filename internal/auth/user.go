@@ -1,7 +1,14 @@
 package auth
 
 type User struct {
+	// ID 账号 ID，游客为空
+	ID   string `json:"id,omitempty"`
 	Name string `json:"name"`
 	// Email salted md5 of email
 	Email string `json:"email"`
 }
+
+// IsGuest 是否为未登录的游客
+func (u User) IsGuest() bool {
+	return u.ID == ""
+}
@@ -1,23 +1,81 @@
 package base
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/tidwall/gjson"
 )
 
 type H = map[string]any
 
-var Config struct {
+// Configuration 服务器配置，字段的 config 标签为配置文件中的路径，
+// 对应的环境变量为 ALISTEN_ 加上大写的路径，路径中的 . 替换为 _，例如 ALISTEN_MUSIC_COOKIE
+type Configuration struct {
 	Addr       string         `config:"addr"`
 	Token      string         `config:"token"`
+	Secret     string         `config:"auth.secret"`
 	Cookie     string         `config:"music.cookie"`
 	NeteaseAPI string         `config:"music.netease"`
 	QQAPI      string         `config:"music.qq"`
+	LocalDir   string         `config:"music.local"` // 本地曲库目录，为空时不启用 local 音乐源
+	PublicURL  string         `config:"url"`         // 服务器对外的地址，用于生成本地音乐的播放地址
 	Pgsql      string         `config:"pgsql"`
 	Debug      bool           `config:"debug"`
+	LogLevel   string         `config:"log.level"`
+	LogJSON    bool           `config:"log.json"`
 	Persist    []PersistHouse `config:"persist"`
+
+	// 房间限制的默认值，未配置的字段使用内置默认值
+	NormalLimits   Limits `config:"limits.normal"`
+	UltimateLimits Limits `config:"limits.ultimate"`
+
+	// musiclet 任务的重试策略，键为任务类型，"*" 为默认策略
+	TaskRetry map[string]TaskRetry `config:"task.retry"`
+
+	// 用户上传音乐，dir 为空时不启用
+	Upload Upload `config:"upload"`
+}
+
+// DefaultUploadMaxSize 默认的上传文件大小限制（MB）
+const DefaultUploadMaxSize = 20
+
+// DefaultUploadFormats 默认允许上传的音频格式
+var DefaultUploadFormats = []string{"mp3", "flac"}
+
+// Upload 用户上传音乐的配置
+type Upload struct {
+	Dir     string   `json:"dir"`     // 上传文件的保存目录
+	MaxSize int64    `json:"maxSize"` // 单个文件的最大大小（MB），0 表示使用默认值
+	Formats []string `json:"formats"` // 允许的格式，为空表示使用默认值
+}
+
+// Limits 返回补全默认值后的大小限制（字节）和允许的格式
+func (u Upload) Limits() (int64, []string) {
+	size, formats := u.MaxSize, u.Formats
+	if size <= 0 {
+		size = DefaultUploadMaxSize
+	}
+	if len(formats) == 0 {
+		formats = DefaultUploadFormats
+	}
+	return size << 20, formats
+}
+
+// TaskRetry musiclet 任务的重试策略，时间单位为秒，0 表示使用默认值
+type TaskRetry struct {
+	Attempts       int  `json:"attempts"`       // 最多分发的次数，包括第一次
+	Lease          int  `json:"lease"`          // 租约时长，worker 需要在到期前发送心跳
+	Backoff        int  `json:"backoff"`        // 重试前等待的时间
+	RetryOnFailure bool `json:"retryOnFailure"` // worker 返回失败结果时是否重试
 }
 
 type PersistHouse struct {
@@ -25,49 +83,184 @@ type PersistHouse struct {
 	Name     string `json:"name"`
 	Desc     string `json:"desc"`
 	Password string `json:"password"`
+	Owner    string `json:"owner"`  // 房主的账号 ID
+	Limits   Limits `json:"limits"` // 频率限制，未配置时使用默认值
+}
+
+// Config 启动时加载的配置，配置重新加载后同步更新，运行中读取配置应使用 Current
+var Config Configuration
+
+var (
+	configMu   sync.RWMutex
+	configPath = "config.json"
+	// configRequired 为 false 时配置文件不存在不视为错误，只使用环境变量和默认值
+	configRequired = false
+)
+
+// Current 返回当前生效的配置
+func Current() Configuration {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return Config
+}
+
+// InitConfig 从配置文件和环境变量加载配置
+//
+// path 为空时读取工作目录下的 config.json，文件不存在时只使用环境变量；
+// 指定 path 时文件必须存在。
+func InitConfig(path string) error {
+	if path != "" {
+		configPath, configRequired = path, true
+	}
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	configMu.Lock()
+	Config = c
+	configMu.Unlock()
+	return nil
+}
+
+// ReloadConfig 重新加载配置，返回重新加载前的配置；加载失败时保留原配置
+func ReloadConfig() (Configuration, error) {
+	c, err := loadConfig()
+	if err != nil {
+		return Current(), err
+	}
+	configMu.Lock()
+	defer configMu.Unlock()
+	old := Config
+	Config = c
+	return old, nil
 }
 
-func InitConfig() {
-	file, _ := os.ReadFile("config.json")
-	g := gjson.Parse(string(file))
+// ConfigPath 返回配置文件的路径
+func ConfigPath() string {
+	return configPath
+}
+
+func loadConfig() (Configuration, error) {
+	var c Configuration
+	file, err := os.ReadFile(configPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !configRequired:
+		slog.Debug("config file not found, using environment only", "path", configPath)
+	case err != nil:
+		return c, fmt.Errorf("read config: %w", err)
+	case !gjson.ValidBytes(file):
+		return c, fmt.Errorf("read config: %s is not valid JSON", configPath)
+	}
+	g := gjson.ParseBytes(file)
 
 	var (
-		v                     = reflect.ValueOf(&Config).Elem()
-		t                     = v.Type()
-		stringType            = reflect.TypeOf("")
-		boolType              = reflect.TypeOf(true)
-		slicePersistHouseType = reflect.TypeOf([]PersistHouse{})
+		v          = reflect.ValueOf(&c).Elem()
+		t          = v.Type()
+		stringType = reflect.TypeOf("")
+		boolType   = reflect.TypeOf(true)
 	)
+	var errs []error
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 		name := field.Tag.Get("config")
 		if name == "" {
 			continue
 		}
+
+		// 环境变量优先于配置文件
+		value := g.Get(name)
+		raw, fromEnv := os.LookupEnv(envName(name))
+		if !fromEnv {
+			raw = value.Raw
+			if value.Type == gjson.String {
+				raw = value.Str
+			}
+		}
+		if !fromEnv && !value.Exists() {
+			continue
+		}
+
+		source := name
+		if fromEnv {
+			source = envName(name)
+		}
 		switch field.Type {
 		case stringType:
-			v.Field(i).SetString(g.Get(name).String())
+			v.Field(i).SetString(raw)
 		case boolType:
-			v.Field(i).SetBool(g.Get(name).Bool())
-		case slicePersistHouseType:
-			// 处理 persist 字段
-			persistData := g.Get(name)
-			if persistData.Exists() && persistData.IsArray() {
-				var houses []PersistHouse
-				persistData.ForEach(func(key, value gjson.Result) bool {
-					house := PersistHouse{
-						ID:       value.Get("id").String(),
-						Name:     value.Get("name").String(),
-						Desc:     value.Get("desc").String(),
-						Password: value.Get("password").String(),
-					}
-					houses = append(houses, house)
-					return true
-				})
-				v.Field(i).Set(reflect.ValueOf(houses))
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: expected a boolean, got %q", source, raw))
+				continue
 			}
+			v.Field(i).SetBool(b)
 		default:
-			panic("unsupported type")
+			// 其他类型的配置项为 JSON，环境变量中同样使用 JSON
+			ptr := reflect.New(field.Type)
+			if err := json.Unmarshal([]byte(raw), ptr.Interface()); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid value: %w", source, err))
+				continue
+			}
+			v.Field(i).Set(ptr.Elem())
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return c, fmt.Errorf("invalid config:\n%w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return c, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return c, nil
+}
+
+// envName 返回配置路径对应的环境变量名
+func envName(path string) string {
+	return "ALISTEN_" + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// Validate 检查配置是否有效，返回所有发现的问题
+func (c *Configuration) Validate() error {
+	var errs []error
+	if !c.Debug && c.Addr == "" {
+		errs = append(errs, errors.New("addr: required unless debug is enabled"))
+	}
+	if c.LogLevel != "" {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(strings.ToUpper(c.LogLevel))); err != nil {
+			errs = append(errs, fmt.Errorf("log.level: unknown level %q, expected debug, info, warn or error", c.LogLevel))
+		}
+	}
+	ids := make(map[string]bool, len(c.Persist))
+	for i, p := range c.Persist {
+		switch {
+		case p.ID == "":
+			errs = append(errs, fmt.Errorf("persist[%d]: id is required", i))
+		case ids[p.ID]:
+			errs = append(errs, fmt.Errorf("persist[%d]: duplicate id %q", i, p.ID))
+		}
+		ids[p.ID] = true
+		if err := p.Limits.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("persist[%d].limits: %w", i, err))
+		}
+	}
+	if err := c.NormalLimits.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("limits.normal: %w", err))
+	}
+	if err := c.UltimateLimits.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("limits.ultimate: %w", err))
+	}
+	if c.Upload.MaxSize < 0 {
+		errs = append(errs, errors.New("upload.maxSize: must not be negative"))
+	}
+	for _, f := range c.Upload.Formats {
+		if !slices.Contains(DefaultUploadFormats, f) {
+			errs = append(errs, fmt.Errorf("upload.formats: unsupported format %q, expected mp3 or flac", f))
+		}
+	}
+	for t, r := range c.TaskRetry {
+		if r.Attempts < 0 || r.Lease < 0 || r.Backoff < 0 {
+			errs = append(errs, fmt.Errorf("task.retry[%s]: values must not be negative", t))
 		}
 	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,65 @@
+package base
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInitConfigEnvOverride(t *testing.T) {
+	path := writeConfig(t, `{"addr": ":8080", "token": "file", "music": {"cookie": "a"}, "persist": [{"id": "room", "name": "r", "limits": {"order": 3}}]}`)
+	t.Setenv("ALISTEN_TOKEN", "env")
+	t.Setenv("ALISTEN_DEBUG", "true")
+
+	if err := InitConfig(path); err != nil {
+		t.Fatalf("InitConfig() error = %v", err)
+	}
+	c := Current()
+	if c.Token != "env" || !c.Debug {
+		t.Errorf("env override: token = %q, debug = %v", c.Token, c.Debug)
+	}
+	if c.Cookie != "a" {
+		t.Errorf("cookie = %q, want a", c.Cookie)
+	}
+	if len(c.Persist) != 1 || c.Persist[0].Limits.Order != 3 {
+		t.Errorf("persist = %+v", c.Persist)
+	}
+}
+
+func TestInitConfigInvalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"json", `{"addr": `, "not valid JSON"},
+		{"bool", `{"addr": ":80", "debug": "yes"}`, "debug: expected a boolean"},
+		{"addr", `{}`, "addr: required"},
+		{"level", `{"addr": ":80", "log": {"level": "loud"}}`, "log.level"},
+		{"persist", `{"addr": ":80", "persist": [{"id": "a"}, {"id": "a"}]}`, "duplicate id"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := InitConfig(writeConfig(t, tc.content))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("InitConfig() error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestInitConfigMissingFile(t *testing.T) {
+	if err := InitConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("InitConfig() with a missing explicit path should fail")
+	}
+}
@@ -0,0 +1,52 @@
+package base
+
+import "errors"
+
+// Limits 房间的限制，0 表示使用默认值，负数表示不限制
+type Limits struct {
+	Search      int     `json:"search,omitempty"`      // 每分钟搜索次数
+	Order       int     `json:"order,omitempty"`       // 每分钟点歌次数
+	Like        int     `json:"like,omitempty"`        // 每分钟点赞次数
+	Queue       int     `json:"queue,omitempty"`       // 播放列表最多歌曲数
+	IdleTimeout int     `json:"idleTimeout,omitempty"` // 无人时自动关闭房间的时间（秒）
+	VoteSkip    float64 `json:"voteSkip,omitempty"`    // 投票切歌需要的在线人数比例，取值为 (0, 1]
+	UserQueue   int     `json:"userQueue,omitempty"`   // 每人最多排队歌曲数
+	UserOrder   int     `json:"userOrder,omitempty"`   // 每人每分钟点歌次数
+}
+
+// Validate 检查限制是否有效
+func (l Limits) Validate() error {
+	if l.VoteSkip < 0 || l.VoteSkip > 1 {
+		return errors.New("voteSkip must be between 0 and 1")
+	}
+	return nil
+}
+
+// Merge 返回用 d 补全 l 中未设置字段后的限制
+func (l Limits) Merge(d Limits) Limits {
+	if l.Search == 0 {
+		l.Search = d.Search
+	}
+	if l.Order == 0 {
+		l.Order = d.Order
+	}
+	if l.Like == 0 {
+		l.Like = d.Like
+	}
+	if l.Queue == 0 {
+		l.Queue = d.Queue
+	}
+	if l.IdleTimeout == 0 {
+		l.IdleTimeout = d.IdleTimeout
+	}
+	if l.VoteSkip == 0 {
+		l.VoteSkip = d.VoteSkip
+	}
+	if l.UserQueue == 0 {
+		l.UserQueue = d.UserQueue
+	}
+	if l.UserOrder == 0 {
+		l.UserOrder = d.UserOrder
+	}
+	return l
+}
@@ -0,0 +1,42 @@
+package base
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// 日志中通用的字段名
+const (
+	LogHouse  = "house"
+	LogConn   = "conn"
+	LogUser   = "user"
+	LogAction = "action"
+	LogTask   = "task"
+	LogSource = "source"
+)
+
+// InitLogger 根据配置初始化默认的 slog 日志
+//
+// log.level 可选 debug、info、warn、error，未配置时默认为 info，
+// 开启 debug 时默认为 debug；log.json 为 true 时输出 JSON 格式。
+func InitLogger() {
+	level := slog.LevelInfo
+	if Config.Debug {
+		level = slog.LevelDebug
+	}
+	if Config.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(strings.ToUpper(Config.LogLevel))); err != nil {
+			slog.Warn("unknown log level, using default", "level", Config.LogLevel, "default", level.String())
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if Config.LogJSON {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
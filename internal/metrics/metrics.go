@@ -0,0 +1,98 @@
+// Package metrics 定义 alisten 暴露给 Prometheus 的监控指标
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "alisten"
+
+// Registry 所有指标注册到的 Registry，由 /metrics 接口导出
+var Registry = prometheus.NewRegistry()
+
+var (
+	// TaskPending 等待 musiclet 领取的任务数
+	TaskPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "task",
+		Name:      "pending",
+		Help:      "Number of tasks waiting to be polled by a musiclet worker.",
+	})
+	// TaskInFlight 正在等待结果的调用数
+	TaskInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "task",
+		Name:      "in_flight",
+		Help:      "Number of task calls waiting for a result.",
+	})
+	// TaskTimeouts 超时未返回结果的任务数
+	TaskTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "task",
+		Name:      "timeouts_total",
+		Help:      "Number of task calls that timed out.",
+	}, []string{"type"})
+	// TaskRetries 重新排队的任务数
+	TaskRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "task",
+		Name:      "retries_total",
+		Help:      "Number of task retries after a lost worker or a failed result.",
+	}, []string{"type"})
+	// TaskDuration 任务从提交到返回结果的耗时
+	TaskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "task",
+		Name:      "duration_seconds",
+		Help:      "Latency of task calls by task type.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 180},
+	}, []string{"type"})
+
+	// ProviderRequests 音乐源请求数
+	ProviderRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "provider",
+		Name:      "requests_total",
+		Help:      "Number of music provider requests by source and operation.",
+	}, []string{"source", "op"})
+	// ProviderErrors 音乐源请求失败数
+	ProviderErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "provider",
+		Name:      "errors_total",
+		Help:      "Number of failed music provider requests by source, operation and error kind.",
+	}, []string{"source", "op", "kind"})
+	// ProviderDuration 音乐源请求耗时
+	ProviderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "provider",
+		Name:      "duration_seconds",
+		Help:      "Latency of music provider requests by source and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"source", "op"})
+
+	// MusicCache GetMusic 缓存命中和未命中次数
+	MusicCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "music_cache",
+		Name:      "requests_total",
+		Help:      "Number of GetMusic cache lookups by result (hit or miss).",
+	}, []string{"result"})
+
+	// RateLimited 被限流拒绝的操作数
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Number of operations rejected by rate limiters by limiter type.",
+	}, []string{"type"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		TaskPending, TaskInFlight, TaskTimeouts, TaskRetries, TaskDuration,
+		ProviderRequests, ProviderErrors, ProviderDuration,
+		MusicCache, RateLimited,
+	)
+}
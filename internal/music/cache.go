@@ -1,71 +1,58 @@
 package music
 
 import (
+	"fmt"
 	"time"
 
-	"github.com/hashicorp/golang-lru/v2/expirable"
-	"github.com/tidwall/gjson"
-
+	"github.com/bihua-university/alisten/internal/metrics"
 	"github.com/bihua-university/alisten/internal/task"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
 )
 
-var cache = expirable.NewLRU[string, H](512, nil, 30*time.Minute)
+var cache = expirable.NewLRU[string, *Track](512, nil, 30*time.Minute)
+
+// GetMusic 获取歌曲
+//
+// useCache 为 true 时只需要歌曲信息，允许返回播放地址已过期的缓存；
+// 否则播放地址过期的歌曲会重新获取。
+func GetMusic(source, id string, useCache bool) (*Track, error) {
+	return GetMusicProgress(source, id, useCache, nil)
+}
 
-func GetMusic(source, id string, useCache bool) H {
+// progressProvider 获取歌曲耗时较长、可以报告进度的音乐源
+type progressProvider interface {
+	GetMusicProgress(id string, fn func(task.Progress)) (*Track, error)
+}
+
+// GetMusicProgress 与 GetMusic 相同，音乐源支持时通过 fn 报告获取进度，fn 可以为 nil
+func GetMusicProgress(source, id string, useCache bool, fn func(task.Progress)) (*Track, error) {
 	key := source + "OvO" + id
-	if useCache || source != "wy" { // 网易云链接有时效性，可以强制刷新
-		if v, ok := cache.Get(key); ok {
-			return v
-		}
+	if v, ok := cache.Get(key); ok && (useCache || !v.Expired()) {
+		metrics.MusicCache.WithLabelValues("hit").Inc()
+		return v, nil
 	}
+	metrics.MusicCache.WithLabelValues("miss").Inc()
 
-	var h H
-	switch source {
-	case "wy":
-		h = getNeteaseMusic(id)
-	case "qq":
-		h = getQQMusic(id)
-	// deprecated, 可以使用common_url平替
-	case "db":
-		t := task.Scheduler.NewTask("bilibili:get_music", map[string]string{"bvid": id})
-		r := task.Scheduler.Call(t, 3*time.Minute)
-		if r != nil && r.Result != nil {
-			rg := gjson.ParseBytes(r.Result)
-			h = H{
-				"type":       rg.Get("type").String(),
-				"url":        rg.Get("url").String(),
-				"id":         id,
-				"webUrl":     rg.Get("webUrl").String(),
-				"pictureUrl": rg.Get("pictureUrl").String(),
-				"duration":   rg.Get("duration").Int(),
-				"source":     "db",
-				"artist":     rg.Get("artist").String(),
-				"name":       rg.Get("name").String(),
-				"album":      rg.Get("al.name").String(),
-			}
-		}
-	case "url_common":
-		// 目前`id`兼职`url`
-		var url string = id
-		t := task.Scheduler.NewTask("url_common:get_music", map[string]string{"url": url})
-		r := task.Scheduler.Call(t, 3*time.Minute)
-		if r != nil && r.Result != nil {
-			rg := gjson.ParseBytes(r.Result)
-			h = H{
-				"type":       rg.Get("type").String(),
-				"url":        rg.Get("url").String(),
-				"id":         id,
-				"webUrl":     url,
-				"pictureUrl": rg.Get("pictureUrl").String(),
-				"duration":   rg.Get("duration").Int(),
-				"source":     "url_common",
-				"artist":     rg.Get("artist").String(),
-				"name":       rg.Get("name").String(),
-				"album":      rg.Get("al.name").String(),
-			}
-		}
+	p, err := provider(source)
+	if err != nil {
+		return nil, err
+	}
+	done := observe(source, "get_music")
+	var t *Track
+	if pp, ok := p.(progressProvider); ok && fn != nil {
+		t, err = pp.GetMusicProgress(id, fn)
+	} else {
+		t, err = p.GetMusic(id)
+	}
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	if t.URL == "" {
+		return nil, fmt.Errorf("%s: %w: empty stream url", source, ErrUpstream)
 	}
 
-	cache.Add(key, h)
-	return h
+	cache.Add(key, t)
+	return t, nil
 }
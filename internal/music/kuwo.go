@@ -0,0 +1,75 @@
+package music
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/music/kuwo"
+)
+
+// kuwoURLTTL 酷我播放地址的有效期，QQ音乐的播放地址也来自酷我
+const kuwoURLTTL = 15 * time.Minute
+
+var kuwoClient = kuwo.New()
+
+func init() {
+	Register(kuwoProvider{}, "kw", "kuwo")
+}
+
+type kuwoProvider struct {
+	UnimplementedProvider
+}
+
+func (kuwoProvider) Search(o SearchOption) (SearchResult[Music], error) {
+	songs, total, err := kuwoClient.Search(o.Keyword, o.Page, o.PageSize)
+	if err != nil {
+		return SearchResult[Music]{}, err
+	}
+	data := make([]*Music, 0, len(songs))
+	for i := range songs {
+		data = append(data, &songs[i])
+	}
+	return SearchResult[Music]{Total: min(total, 100), Data: data}, nil
+}
+
+func (p kuwoProvider) GetMusic(id string) (*Track, error) {
+	detail, err := kuwoClient.GetSongDetail(id)
+	if err != nil {
+		return nil, err
+	}
+	url, err := p.GetStreamURL(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Track{
+		Type:       "music",
+		URL:        url,
+		WebURL:     p.WebURL(id),
+		PictureURL: detail.Cover,
+		Duration:   detail.Duration,
+		Source:     "kuwo",
+		Lyric:      detail.Lyric,
+		Artist:     detail.Artist,
+		Name:       detail.Name,
+		Album:      detail.Album,
+		ID:         id,
+		URLExpire:  time.Now().Add(kuwoURLTTL),
+	}, nil
+}
+
+func (kuwoProvider) GetStreamURL(id string) (string, error) {
+	return kuwoClient.GetDownloadURL(id)
+}
+
+func (kuwoProvider) GetLyrics(id string) (string, error) {
+	detail, err := kuwoClient.GetSongDetail(id)
+	if err != nil {
+		return "", err
+	}
+	return detail.Lyric, nil
+}
+
+func (kuwoProvider) WebURL(id string) string {
+	return fmt.Sprintf("https://www.kuwo.cn/play_detail/%s", id)
+}
@@ -1,6 +1,7 @@
 package kuwo
 
 import (
+	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
@@ -12,6 +13,7 @@ import (
 
 const (
 	userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/134.0.0.0 Safari/537.36"
+	coverBase = "https://img4.kuwo.cn/star/albumcover/"
 )
 
 type Kuwo struct{}
@@ -20,7 +22,8 @@ func New() *Kuwo {
 	return &Kuwo{}
 }
 
-func (k *Kuwo) Search(keyword string) ([]types.Music, error) {
+// Search 搜索歌曲，page 从 1 开始，返回当前页的歌曲和总数
+func (k *Kuwo) Search(keyword string, page, pageSize int64) ([]types.Music, int64, error) {
 	params := url.Values{}
 	params.Set("vipver", "1")
 	params.Set("client", "kt")
@@ -32,8 +35,8 @@ func (k *Kuwo) Search(keyword string) ([]types.Music, error) {
 	params.Set("mobi", "1")
 	params.Set("issubtitle", "1")
 	params.Set("show_copyright_off", "1")
-	params.Set("pn", "0")
-	params.Set("rn", "10")
+	params.Set("pn", strconv.FormatInt(max(page-1, 0), 10))
+	params.Set("rn", strconv.FormatInt(pageSize, 10))
 	params.Set("all", keyword)
 
 	apiURL := "http://www.kuwo.cn/search/searchMusicBykeyWord?" + params.Encode()
@@ -43,12 +46,17 @@ func (k *Kuwo) Search(keyword string) ([]types.Music, error) {
 		utils.WithRandomIPHeader(),
 	)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	result := gjson.ParseBytes(body).Get("abslist")
+	r := gjson.ParseBytes(body)
+	if !r.Get("abslist").Exists() {
+		return nil, 0, fmt.Errorf("%w: kuwo search failed: %s", types.ErrUpstream, truncate(body))
+	}
+	total, _ := strconv.ParseInt(r.Get("TOTAL").String(), 10, 64)
+
 	var songs []types.Music
-	result.ForEach(func(_, item gjson.Result) bool {
+	r.Get("abslist").ForEach(func(_, item gjson.Result) bool {
 		if item.Get("bitSwitch").Int() == 0 {
 			return true
 		}
@@ -62,11 +70,30 @@ func (k *Kuwo) Search(keyword string) ([]types.Music, error) {
 			Artist:   item.Get("ARTIST").String(),
 			Album:    item.Get("ALBUM").String(),
 			Duration: duration * 1000,
-			Cover:    item.Get("hts_MVPIC").String(),
+			Cover:    albumCover(item.Get("web_albumpic_short").String()),
 			Source:   types.KuWo,
 		})
 		return true
 	})
 
-	return songs, nil
+	return songs, total, nil
+}
+
+// albumCover 将搜索结果中的封面短路径转换为 500px 的封面地址
+func albumCover(short string) string {
+	if short == "" {
+		return ""
+	}
+	if i := strings.Index(short, "/"); i >= 0 {
+		short = "500" + short[i:]
+	}
+	return coverBase + short
+}
+
+func truncate(body []byte) string {
+	const n = 128
+	if len(body) > n {
+		return string(body[:n]) + "..."
+	}
+	return string(body)
 }
@@ -0,0 +1,72 @@
+package kuwo
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/bihua-university/alisten/internal/music/types"
+	"github.com/bihua-university/alisten/internal/music/utils"
+)
+
+// SongDetail 酷我歌曲详情
+type SongDetail struct {
+	Name     string
+	Artist   string
+	Album    string
+	Duration int64 // 毫秒
+	Cover    string
+	Lyric    string // LRC 格式歌词
+}
+
+// GetSongDetail 获取歌曲详情和歌词
+func (k *Kuwo) GetSongDetail(rid string) (*SongDetail, error) {
+	apiURL := "http://m.kuwo.cn/newh5/singles/songinfoandlrc?musicId=" + rid
+	body, err := utils.Get(apiURL,
+		utils.WithHeader("User-Agent", userAgent),
+		utils.WithRandomIPHeader(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return parseSongDetail(rid, body)
+}
+
+// parseSongDetail 解析歌曲详情接口的响应
+func parseSongDetail(rid string, body []byte) (*SongDetail, error) {
+	r := gjson.ParseBytes(body)
+	// 歌曲不存在时 status 为 200 或 404，songinfo 为 null
+	info := r.Get("data.songinfo")
+	switch status := r.Get("status").Int(); {
+	case status == http.StatusNotFound, status == http.StatusOK && !info.IsObject():
+		return nil, fmt.Errorf("%w: kuwo song %s", types.ErrNotFound, rid)
+	case status != http.StatusOK:
+		return nil, fmt.Errorf("%w: kuwo api error status: %d", types.ErrUpstream, status)
+	}
+
+	duration, _ := strconv.ParseInt(info.Get("duration").String(), 10, 64)
+	return &SongDetail{
+		Name:     info.Get("songName").String(),
+		Artist:   strings.ReplaceAll(info.Get("artist").String(), "&", ", "),
+		Album:    info.Get("album").String(),
+		Duration: duration * 1000,
+		Cover:    info.Get("pic").String(),
+		Lyric:    toLRC(r.Get("data.lrclist")),
+	}, nil
+}
+
+// toLRC 将酷我的逐行歌词转换为 LRC 格式
+func toLRC(list gjson.Result) string {
+	var sb strings.Builder
+	list.ForEach(func(_, line gjson.Result) bool {
+		t := line.Get("time").Float()
+		m := int(t) / 60
+		s := t - float64(m*60)
+		fmt.Fprintf(&sb, "[%02d:%05.2f]%s\n", m, s, line.Get("lineLyric").String())
+		return true
+	})
+	return sb.String()
+}
@@ -0,0 +1,30 @@
+package kuwo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bihua-university/alisten/internal/music/types"
+)
+
+func TestParseSongDetail(t *testing.T) {
+	tests := []struct {
+		body string
+		want error
+	}{
+		{`{"status":200,"data":{"songinfo":{"songName":"a","duration":"61"},"lrclist":null}}`, nil},
+		{`{"status":200,"data":{"songinfo":null,"lrclist":null}}`, types.ErrNotFound},
+		{`{"status":404,"msg":"not found"}`, types.ErrNotFound},
+		{`{"status":500}`, types.ErrUpstream},
+		{`<html>`, types.ErrUpstream},
+	}
+	for _, tt := range tests {
+		d, err := parseSongDetail("1", []byte(tt.body))
+		if !errors.Is(err, tt.want) || (tt.want != nil && err == nil) {
+			t.Errorf("parseSongDetail(%s) error = %v, want %v", tt.body, err, tt.want)
+		}
+		if err == nil && (d.Name != "a" || d.Duration != 61000) {
+			t.Errorf("parseSongDetail(%s) = %+v", tt.body, d)
+		}
+	}
+}
@@ -1,12 +1,12 @@
 package kuwo
 
 import (
-	"errors"
 	"fmt"
 	"math/rand"
 	"net/url"
 	"time"
 
+	"github.com/bihua-university/alisten/internal/music/types"
 	"github.com/bihua-university/alisten/internal/music/utils"
 	"github.com/tidwall/gjson"
 )
@@ -50,9 +50,11 @@ func (k *Kuwo) GetDownloadURL(rid string) (string, error) {
 		utils.WithRandomIPHeader(),
 	)
 	if err != nil {
-		return "", errors.New("download url not found")
-
+		return "", err
 	}
 	url := gjson.ParseBytes(fallbackBody).Get("data.url").String()
+	if url == "" {
+		return "", fmt.Errorf("%w: kuwo download url not found", types.ErrCopyright)
+	}
 	return url, nil
 }
@@ -0,0 +1,122 @@
+package music
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/music/local"
+)
+
+// localURLMargin 本地和上传音乐的播放地址在过期前多久视为过期，保证播放中的歌曲可以继续拖动进度
+const localURLMargin = time.Hour
+
+var localLibrary atomic.Pointer[local.Library]
+
+// SetLocalLibrary 设置本地曲库，nil 表示不启用本地音乐源
+func SetLocalLibrary(l *local.Library) {
+	localLibrary.Store(l)
+}
+
+// LocalLibrary 返回本地曲库，未启用时返回 nil
+func LocalLibrary() *local.Library {
+	return localLibrary.Load()
+}
+
+func init() {
+	Register(localProvider{}, "local")
+}
+
+// localProvider 服务器本地目录中的音乐
+type localProvider struct {
+	UnimplementedProvider
+}
+
+func (localProvider) library() (*local.Library, error) {
+	if l := localLibrary.Load(); l != nil {
+		return l, nil
+	}
+	return nil, fmt.Errorf("%w: local library is not configured", ErrNotSupported)
+}
+
+func (p localProvider) Search(o SearchOption) (SearchResult[Music], error) {
+	l, err := p.library()
+	if err != nil {
+		return SearchResult[Music]{}, err
+	}
+	total, entries := l.Search(o.Keyword, int((o.Page-1)*o.PageSize), int(o.PageSize))
+	data := make([]*Music, 0, len(entries))
+	for _, e := range entries {
+		data = append(data, &Music{
+			ID:       e.ID,
+			Name:     e.Name,
+			Artist:   e.Artist,
+			Album:    e.Album,
+			Duration: e.Duration,
+			Cover:    l.CoverURL(e.ID),
+			Source:   Local,
+		})
+	}
+	return SearchResult[Music]{Total: int64(total), Data: data}, nil
+}
+
+func (p localProvider) GetMusic(id string) (*Track, error) {
+	l, err := p.library()
+	if err != nil {
+		return nil, err
+	}
+	e, err := l.Get(id)
+	if err != nil {
+		return nil, localError(err)
+	}
+	lyric, err := l.Lyric(id)
+	if err != nil {
+		return nil, localError(err)
+	}
+	u, expires := l.StreamURL(id)
+	return &Track{
+		Album:      e.Album,
+		Artist:     e.Artist,
+		Duration:   e.Duration,
+		ID:         id,
+		Lyric:      lyric,
+		Name:       e.Name,
+		PictureURL: l.CoverURL(id),
+		Source:     "local",
+		Type:       "music",
+		URL:        u,
+		URLExpire:  expires.Add(-localURLMargin),
+	}, nil
+}
+
+func (p localProvider) GetStreamURL(id string) (string, error) {
+	l, err := p.library()
+	if err != nil {
+		return "", err
+	}
+	if _, err := l.Get(id); err != nil {
+		return "", localError(err)
+	}
+	u, _ := l.StreamURL(id)
+	return u, nil
+}
+
+func (p localProvider) GetLyrics(id string) (string, error) {
+	l, err := p.library()
+	if err != nil {
+		return "", err
+	}
+	lyric, err := l.Lyric(id)
+	if err != nil {
+		return "", localError(err)
+	}
+	return lyric, nil
+}
+
+func localError(err error) error {
+	if errors.Is(err, local.ErrNotFound) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,267 @@
+// Package local 索引本地目录中的音乐文件，并通过签名的限时地址提供播放
+package local
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/audio"
+)
+
+// ErrNotFound 歌曲不在曲库中
+var ErrNotFound = errors.New("local track not found")
+
+// Entry 曲库中的一首歌
+type Entry struct {
+	ID       string `json:"id"` // 相对于曲库目录的路径，以 / 分隔
+	Name     string `json:"name"`
+	Artist   string `json:"artist"`
+	Album    string `json:"album"`
+	Duration int64  `json:"duration"` // 毫秒
+	Format   string `json:"format"`
+	Cover    bool   `json:"cover"` // 是否有内嵌封面
+	Lyric    bool   `json:"lyric"` // 是否有同名的 .lrc 歌词文件
+
+	size    int64
+	modTime time.Time
+}
+
+// Library 本地曲库，Scan 之后可以并发使用
+type Library struct {
+	dir     string
+	signer  *Signer
+	baseURL string     // 播放地址的前缀，为空时生成相对地址
+	scanMu  sync.Mutex // 同一时间只进行一次扫描
+
+	mu      sync.RWMutex
+	entries map[string]*Entry
+	sorted  []*Entry // 按 ID 排序
+}
+
+// New 创建目录 dir 的曲库，需要调用 Scan 建立索引
+//
+// 播放地址使用 key 签名，baseURL 为服务器对外的地址。
+func New(dir string, key []byte, baseURL string) *Library {
+	return &Library{
+		dir:     dir,
+		signer:  NewSigner(key),
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		entries: make(map[string]*Entry),
+	}
+}
+
+// Dir 返回曲库目录
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+// BaseURL 返回播放地址的前缀
+func (l *Library) BaseURL() string {
+	return l.baseURL
+}
+
+// Len 返回曲库中的歌曲数
+func (l *Library) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.sorted)
+}
+
+// Scan 重新扫描曲库目录，大小和修改时间没有变化的文件不会重新读取
+func (l *Library) Scan() error {
+	l.scanMu.Lock()
+	defer l.scanMu.Unlock()
+
+	st, err := os.Stat(l.dir)
+	if err != nil {
+		return fmt.Errorf("scan %s: %w", l.dir, err)
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("scan %s: not a directory", l.dir)
+	}
+
+	l.mu.RLock()
+	old := l.entries
+	l.mu.RUnlock()
+
+	entries := make(map[string]*Entry, len(old))
+	err = filepath.WalkDir(l.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			slog.Warn("scan local music", "path", p, "error", err)
+			return nil
+		}
+		// 只收录普通文件，符号链接可能指向 music.local 以外的文件
+		if !d.Type().IsRegular() || !isAudio(p) {
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return nil
+		}
+		id := filepath.ToSlash(rel)
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if e := old[id]; e != nil && e.size == fi.Size() && e.modTime.Equal(fi.ModTime()) {
+			c := *e
+			c.Lyric = fileExists(lyricPath(p))
+			entries[id] = &c
+			return nil
+		}
+
+		e, err := probe(p, id)
+		if err != nil {
+			slog.Warn("skip local music", "path", p, "error", err)
+			return nil
+		}
+		e.size, e.modTime = fi.Size(), fi.ModTime()
+		entries[id] = e
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("scan %s: %w", l.dir, err)
+	}
+
+	sorted := slices.SortedFunc(maps.Values(entries), func(a, b *Entry) int { return cmp.Compare(a.ID, b.ID) })
+
+	l.mu.Lock()
+	l.entries, l.sorted = entries, sorted
+	l.mu.Unlock()
+	return nil
+}
+
+// Get 返回 id 对应的歌曲
+func (l *Library) Get(id string) (*Entry, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if e := l.entries[id]; e != nil {
+		return e, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// Search 按歌名、歌手、专辑和路径搜索，不区分大小写，keyword 为空时返回所有歌曲
+func (l *Library) Search(keyword string, offset, limit int) (int, []*Entry) {
+	keyword = strings.ToLower(strings.TrimSpace(keyword))
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var matched []*Entry
+	for _, e := range l.sorted {
+		if keyword == "" || matches(e, keyword) {
+			matched = append(matched, e)
+		}
+	}
+	if offset >= len(matched) {
+		return len(matched), nil
+	}
+	return len(matched), matched[offset:min(offset+limit, len(matched))]
+}
+
+func matches(e *Entry, keyword string) bool {
+	for _, s := range []string{e.Name, e.Artist, e.Album, e.ID} {
+		if strings.Contains(strings.ToLower(s), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lyric 读取歌曲同名的 .lrc 歌词，没有歌词时返回空字符串
+func (l *Library) Lyric(id string) (string, error) {
+	e, err := l.Get(id)
+	if err != nil || !e.Lyric {
+		return "", err
+	}
+	b, err := os.ReadFile(lyricPath(l.path(e)))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(string(b), "\ufeff"), nil
+}
+
+// Cover 读取歌曲的内嵌封面
+func (l *Library) Cover(id string) (*audio.Picture, error) {
+	e, err := l.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !e.Cover {
+		return nil, fmt.Errorf("%w: %s has no cover", ErrNotFound, id)
+	}
+	f, err := os.Open(l.path(e))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := audio.Probe(f)
+	if err != nil {
+		return nil, err
+	}
+	if info.Picture == nil {
+		return nil, fmt.Errorf("%w: %s has no cover", ErrNotFound, id)
+	}
+	return info.Picture, nil
+}
+
+// path 返回歌曲文件的路径，ID 来自扫描结果，不会超出曲库目录
+func (l *Library) path(e *Entry) string {
+	return filepath.Join(l.dir, filepath.FromSlash(e.ID))
+}
+
+func probe(p, id string) (*Entry, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := audio.Probe(f)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Entry{
+		ID:       id,
+		Name:     info.Title,
+		Artist:   info.Artist,
+		Album:    info.Album,
+		Duration: info.Duration,
+		Format:   info.Format,
+		Cover:    info.Picture != nil,
+		Lyric:    fileExists(lyricPath(p)),
+	}
+	if e.Name == "" {
+		e.Name = strings.TrimSuffix(path.Base(id), path.Ext(id))
+	}
+	return e, nil
+}
+
+func isAudio(p string) bool {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".mp3", ".flac":
+		return true
+	}
+	return false
+}
+
+func lyricPath(p string) string {
+	return strings.TrimSuffix(p, filepath.Ext(p)) + ".lrc"
+}
+
+// fileExists 判断 p 是否为普通文件，不跟随符号链接
+func fileExists(p string) bool {
+	fi, err := os.Lstat(p)
+	return err == nil && fi.Mode().IsRegular()
+}
@@ -0,0 +1,107 @@
+package local
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeMP3 写入 10 帧 128kbps 的 MP3 文件
+func writeMP3(t *testing.T, p string) {
+	t.Helper()
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, bytes.Repeat(frame, 10), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	dir := t.TempDir()
+	writeMP3(t, filepath.Join(dir, "Artist", "Song A.mp3"))
+	writeMP3(t, filepath.Join(dir, "Song B.mp3"))
+	os.WriteFile(filepath.Join(dir, "Song B.lrc"), []byte("[00:00.00]hello"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not music"), 0o644)
+	// 指向目录以外的符号链接不应被收录
+	outside := t.TempDir()
+	writeMP3(t, filepath.Join(outside, "Song C.mp3"))
+	os.WriteFile(filepath.Join(outside, "secret.lrc"), []byte("secret"), 0o644)
+	os.Symlink(filepath.Join(outside, "Song C.mp3"), filepath.Join(dir, "Song C.mp3"))
+	os.Symlink(outside, filepath.Join(dir, "Linked"))
+	writeMP3(t, filepath.Join(dir, "Song D.mp3"))
+	os.Symlink(filepath.Join(outside, "secret.lrc"), filepath.Join(dir, "Song D.lrc"))
+
+	l := New(dir, []byte("key"), "http://example.com/")
+	if err := l.Scan(); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if total, entries := l.Search("song", 0, 10); total != 3 || entries[0].ID != "Artist/Song A.mp3" {
+		t.Fatalf("Search(song) = %d %+v, want Artist/Song A.mp3 first", total, entries)
+	}
+	if total, entries := l.Search("ARTIST", 0, 10); total != 1 || entries[0].Name != "Song A" {
+		t.Errorf("Search(ARTIST) = %d %+v, want Song A", total, entries)
+	}
+	if lyric, err := l.Lyric("Song B.mp3"); err != nil || lyric != "[00:00.00]hello" {
+		t.Errorf("Lyric(Song B) = %q, %v", lyric, err)
+	}
+	if lyric, err := l.Lyric("Song D.mp3"); err != nil || lyric != "" {
+		t.Errorf("Lyric(Song D) = %q, %v, want no lyric from symlink", lyric, err)
+	}
+	for _, id := range []string{"Song C.mp3", "Linked/Song C.mp3"} {
+		if _, err := l.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%s) error = %v, want ErrNotFound", id, err)
+		}
+	}
+	if _, err := l.Get("../etc/passwd"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(../etc/passwd) error = %v, want ErrNotFound", err)
+	}
+
+	u, _ := l.StreamURL("Song B.mp3")
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host != "example.com" || parsed.Path != StreamPath {
+		t.Fatalf("StreamURL() = %s", u)
+	}
+	req := httptest.NewRequest("GET", parsed.RequestURI(), nil)
+	req.Header.Set("Range", "bytes=0-99")
+	w := httptest.NewRecorder()
+	l.ServeStream(w, req)
+	if w.Code != http.StatusPartialContent || w.Body.Len() != 100 {
+		t.Errorf("ServeStream(range) = %d with %d bytes, want 206 with 100 bytes", w.Code, w.Body.Len())
+	}
+
+	// 修改签名中的 ID
+	q := parsed.Query()
+	q.Set("id", "Artist/Song A.mp3")
+	w = httptest.NewRecorder()
+	l.ServeStream(w, httptest.NewRequest("GET", StreamPath+"?"+q.Encode(), nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("ServeStream(tampered) = %d, want 403", w.Code)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	s := NewSigner([]byte("key"))
+	q := s.Sign("stream", "a.mp3", time.Now().Add(time.Minute))
+	if id, err := s.Verify("stream", q); err != nil || id != "a.mp3" {
+		t.Errorf("Verify() = %q, %v, want a.mp3", id, err)
+	}
+	if _, err := s.Verify("cover", q); !errors.Is(err, ErrSignature) {
+		t.Errorf("Verify(cover) error = %v, want ErrSignature", err)
+	}
+	if _, err := NewSigner([]byte("other")).Verify("stream", q); !errors.Is(err, ErrSignature) {
+		t.Errorf("Verify(other key) error = %v, want ErrSignature", err)
+	}
+	expired := s.Sign("stream", "a.mp3", time.Now().Add(-time.Second))
+	if _, err := s.Verify("stream", expired); !errors.Is(err, ErrExpired) {
+		t.Errorf("Verify(expired) error = %v, want ErrExpired", err)
+	}
+}
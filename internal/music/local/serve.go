@@ -0,0 +1,97 @@
+package local
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/audio"
+)
+
+// 曲库的 HTTP 接口路径
+const (
+	StreamPath = "/music/local/stream"
+	CoverPath  = "/music/local/cover"
+)
+
+// URLTTL 播放地址的有效期
+const URLTTL = 6 * time.Hour
+
+// StreamURL 返回歌曲的签名播放地址和过期时间
+func (l *Library) StreamURL(id string) (string, time.Time) {
+	expires := time.Now().Add(URLTTL)
+	return l.baseURL + StreamPath + "?" + l.signer.Sign("stream", id, expires).Encode(), expires
+}
+
+// CoverURL 返回歌曲封面的签名地址，没有封面时返回空字符串
+func (l *Library) CoverURL(id string) string {
+	e, err := l.Get(id)
+	if err != nil || !e.Cover {
+		return ""
+	}
+	return l.baseURL + CoverPath + "?" + l.signer.Sign("cover", id, time.Now().Add(URLTTL)).Encode()
+}
+
+// ServeStream 提供签名地址对应的音频文件，支持 Range 请求
+func (l *Library) ServeStream(w http.ResponseWriter, r *http.Request) {
+	e, ok := l.verify(w, r, "stream")
+	if !ok {
+		return
+	}
+	f, err := os.Open(l.path(e))
+	if err != nil {
+		slog.Warn("open local music", "id", e.ID, "error", err)
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", audio.MIMEType(e.Format))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
+
+// ServeCover 提供签名地址对应的内嵌封面
+func (l *Library) ServeCover(w http.ResponseWriter, r *http.Request) {
+	e, ok := l.verify(w, r, "cover")
+	if !ok {
+		return
+	}
+	p, err := l.Cover(e.ID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if p.MIMEType != "" {
+		w.Header().Set("Content-Type", p.MIMEType)
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, "", e.modTime, bytes.NewReader(p.Data))
+}
+
+// verify 检查请求的签名，失败时写入错误响应
+func (l *Library) verify(w http.ResponseWriter, r *http.Request, kind string) (*Entry, bool) {
+	id, err := l.signer.Verify(kind, r.URL.Query())
+	switch {
+	case errors.Is(err, ErrExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+		return nil, false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, false
+	}
+	e, err := l.Get(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return e, true
+}
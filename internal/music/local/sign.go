@@ -0,0 +1,60 @@
+package local
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrSignature 地址的签名无效
+	ErrSignature = errors.New("invalid signature")
+	// ErrExpired 地址已过期
+	ErrExpired = errors.New("url expired")
+)
+
+// Signer 为播放地址签名，签名覆盖用途、ID 和过期时间
+type Signer struct {
+	key []byte
+}
+
+// NewSigner 使用 key 创建签名器，key 变化后之前签发的地址全部失效
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+// Sign 返回 id 在 expires 之前有效的查询参数，kind 区分地址的用途，例如 stream 和 cover
+func (s *Signer) Sign(kind, id string, expires time.Time) url.Values {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return url.Values{
+		"id":  {id},
+		"exp": {exp},
+		"sig": {s.mac(kind, id, exp)},
+	}
+}
+
+// Verify 检查查询参数的签名和有效期，返回签名的 id
+func (s *Signer) Verify(kind string, q url.Values) (string, error) {
+	id, exp, sig := q.Get("id"), q.Get("exp"), q.Get("sig")
+	if !hmac.Equal([]byte(sig), []byte(s.mac(kind, id, exp))) {
+		return "", ErrSignature
+	}
+	t, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return "", ErrSignature
+	}
+	if time.Now().Unix() > t {
+		return "", ErrExpired
+	}
+	return id, nil
+}
+
+func (s *Signer) mac(kind, id, exp string) string {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(kind + "\n" + id + "\n" + exp))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
@@ -1,38 +1,47 @@
 package music
 
 import (
-	"fmt"
-
 	"github.com/bihua-university/alisten/internal/music/types"
 )
 
 // GenerateWebURL generates the web URL for a music track based on source and ID
 func GenerateWebURL(source, id string) string {
-	switch source {
-	case "wy", "netease":
-		return fmt.Sprintf("https://music.163.com/#/song?id=%s", id)
-	case "qq":
-		return fmt.Sprintf("https://y.qq.com/n/ryqq/songDetail/%s", id)
-	case "db":
-		return fmt.Sprintf("https://www.bilibili.com/video/%s", id)
-	default:
-		return ""
+	if p := GetProvider(source); p != nil {
+		return p.WebURL(id)
 	}
+	return ""
 }
 
 type Source = types.Source
 
+// 音乐源错误的类别，见 types.Kind
+var (
+	ErrUpstream     = types.ErrUpstream
+	ErrCopyright    = types.ErrCopyright
+	ErrVIP          = types.ErrVIP
+	ErrRateLimited  = types.ErrRateLimited
+	ErrTimeout      = types.ErrTimeout
+	ErrNotFound     = types.ErrNotFound
+	ErrNotSupported = types.ErrNotSupported
+)
+
+// ErrorKind 返回错误所属的类别
+func ErrorKind(err error) error {
+	return types.Kind(err)
+}
+
 const (
 	QQ Source = iota
 	NetEase
 	KuWo
+	Local
 )
 
 type Music = types.Music
 
-type Playlist = types.Playlist
+type Track = types.Track
 
-type H = map[string]interface{}
+type Playlist = types.Playlist
 
 type SearchOption struct {
 	ID       string
@@ -54,4 +63,5 @@ func (o *SearchOption) normalize() {
 type SearchResult[T any] struct {
 	Total int64
 	Data  []*T
+	Err   error // 搜索失败的原因
 }
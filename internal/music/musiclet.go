@@ -0,0 +1,143 @@
+package music
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/bihua-university/alisten/internal/task"
+)
+
+func init() {
+	// deprecated, 可以使用common_url平替
+	Register(&musicletProvider{
+		source:     "db",
+		getTask:    "bilibili:get_music",
+		getKey:     "bvid",
+		searchTask: "bilibili:search_music",
+		webURL: func(id string) string {
+			return fmt.Sprintf("https://www.bilibili.com/video/%s", id)
+		},
+	}, "db")
+	// 目前`id`兼职`url`
+	Register(&musicletProvider{
+		source:  "url_common",
+		getTask: "url_common:get_music",
+		getKey:  "url",
+		webURL:  func(id string) string { return id },
+	}, "url_common")
+	// musiclet 本地目录中的文件，`id` 为文件地址或相对路径，只交给启用了本地文件处理器的 worker
+	Register(&musicletProvider{
+		source:  "file",
+		getTask: "local:get_music",
+		getKey:  "url",
+		webURL:  func(id string) string { return id },
+	}, "file")
+}
+
+// musicletProvider 通过 musiclet 任务获取音乐的音乐源
+type musicletProvider struct {
+	UnimplementedProvider
+	source     string
+	getTask    string // 获取音乐的任务类型
+	getKey     string // 获取音乐任务中 id 对应的参数名
+	searchTask string // 搜索任务类型，为空表示不支持搜索
+	webURL     func(id string) string
+}
+
+func (p *musicletProvider) Search(o SearchOption) (SearchResult[Music], error) {
+	if p.searchTask == "" {
+		return SearchResult[Music]{}, ErrNotSupported
+	}
+	t, err := task.Scheduler.NewTask(p.searchTask, map[string]string{
+		"keyword":  o.Keyword,
+		"page":     fmt.Sprintf("%d", o.Page),
+		"pageSize": fmt.Sprintf("%d", o.PageSize),
+	})
+	if err != nil {
+		return SearchResult[Music]{}, fmt.Errorf("%w: %w", ErrUpstream, err)
+	}
+	r, err := callMusiclet(t, 1*time.Minute, nil)
+	if err != nil {
+		return SearchResult[Music]{}, err
+	}
+
+	var res struct {
+		Data  []*Music `json:"data"`
+		Total int      `json:"total"`
+	}
+	if err := json.Unmarshal([]byte(r.Result), &res); err != nil {
+		return SearchResult[Music]{}, err
+	}
+	return SearchResult[Music]{
+		Total: int64(res.Total),
+		Data:  res.Data,
+	}, nil
+}
+
+func (p *musicletProvider) GetMusic(id string) (*Track, error) {
+	return p.GetMusicProgress(id, nil)
+}
+
+// GetMusicProgress 获取歌曲，worker 报告的进度交给 fn
+func (p *musicletProvider) GetMusicProgress(id string, fn func(task.Progress)) (*Track, error) {
+	t, err := task.Scheduler.NewTask(p.getTask, map[string]string{p.getKey: id})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUpstream, err)
+	}
+	r, err := callMusiclet(t, 3*time.Minute, fn)
+	if err != nil {
+		return nil, err
+	}
+	rg := gjson.ParseBytes(r.Result)
+	webURL := p.WebURL(id)
+	if webURL == "" {
+		webURL = rg.Get("webUrl").String()
+	}
+	return &Track{
+		Type:       rg.Get("type").String(),
+		URL:        rg.Get("url").String(),
+		ID:         id,
+		WebURL:     webURL,
+		PictureURL: rg.Get("pictureUrl").String(),
+		Duration:   rg.Get("duration").Int(),
+		Source:     p.source,
+		Artist:     rg.Get("artist").String(),
+		Name:       rg.Get("name").String(),
+		Album:      rg.Get("al.name").String(),
+	}, nil
+}
+
+func (p *musicletProvider) GetStreamURL(id string) (string, error) {
+	m, err := p.GetMusic(id)
+	if err != nil {
+		return "", err
+	}
+	return m.URL, nil
+}
+
+func (p *musicletProvider) WebURL(id string) string {
+	return p.webURL(id)
+}
+
+// callMusiclet 调用 musiclet 任务，超时或失败时返回对应类别的错误，progress 不为 nil 时接收任务进度
+func callMusiclet(t *task.Task, timeout time.Duration, progress func(task.Progress)) (*task.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if progress != nil {
+		ctx = task.WithProgress(ctx, progress)
+	}
+	r := task.Scheduler.CallContext(ctx, t)
+	switch {
+	case r == nil:
+		return nil, fmt.Errorf("%w: musiclet task %s", ErrTimeout, t.Type)
+	case !r.Success:
+		return nil, fmt.Errorf("%w: musiclet task %s: %s", ErrUpstream, t.Type, r.Error)
+	case r.Result == nil:
+		return nil, fmt.Errorf("%w: musiclet task %s returned no result", ErrUpstream, t.Type)
+	}
+	return r, nil
+}
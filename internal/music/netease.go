@@ -1,43 +1,188 @@
 package music
 
 import (
+	"fmt"
 	"strings"
-	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bihua-university/alisten/internal/base"
 	"github.com/bihua-university/alisten/internal/music/netease"
 	"github.com/tidwall/gjson"
 )
 
-var neteaseClient = sync.OnceValue(func() *netease.Netease { return netease.New(base.Config.Cookie) })
+// neteaseURLTTL 网易云播放地址的有效期，实际有效期约为 20 分钟
+const neteaseURLTTL = 15 * time.Minute
 
-func getNeteaseMusic(id string) H {
+var neteaseClientPtr atomic.Pointer[netease.Netease]
+
+func neteaseClient() *netease.Netease {
+	if c := neteaseClientPtr.Load(); c != nil {
+		return c
+	}
+	neteaseClientPtr.CompareAndSwap(nil, netease.New(base.Current().Cookie))
+	return neteaseClientPtr.Load()
+}
+
+// SetCookie 使用新的 Cookie 重建音乐平台客户端
+func SetCookie(cookie string) {
+	neteaseClientPtr.Store(netease.New(cookie))
+}
+
+func init() {
+	Register(neteaseProvider{}, "wy", "netease")
+}
+
+type neteaseProvider struct{}
+
+func (neteaseProvider) Search(o SearchOption) (SearchResult[Music], error) {
+	client := neteaseClient()
+	result, err := client.Search(o.Keyword)
+	if err != nil {
+		return SearchResult[Music]{}, err
+	}
+	start := (o.Page - 1) * o.PageSize
+	end := start + o.PageSize
+	var data []*Music
+	var idx int64
+	result.Get("songs").ForEach(func(_, item gjson.Result) bool {
+		if idx >= start && idx < end {
+			data = append(data, parseNeteaseSong(item))
+		}
+		idx++
+		return idx < end
+	})
+	return SearchResult[Music]{Total: min(result.Get("songCount").Int(), 100), Data: data}, nil
+}
+
+func (neteaseProvider) SearchPlaylist(o SearchOption) (SearchResult[Playlist], error) {
+	client := neteaseClient()
+	result, err := client.SearchPlaylist(o.Keyword)
+	if err != nil {
+		return SearchResult[Playlist]{}, err
+	}
+	start := (o.Page - 1) * o.PageSize
+	end := start + o.PageSize
+	var data []*Playlist
+	var idx int64
+	result.Get("playlists").ForEach(func(_, item gjson.Result) bool {
+		if idx >= start && idx < end {
+			data = append(data, &Playlist{
+				ID:         item.Get("id").String(),
+				Name:       item.Get("name").String(),
+				PictureURL: item.Get("coverImgUrl").String(),
+				Desc:       item.Get("description").String(),
+				Creator:    item.Get("creator.nickname").String(),
+				PlayCount:  item.Get("playCount").Int(),
+				SongCount:  item.Get("trackCount").Int(),
+			})
+		}
+		idx++
+		return idx < end
+	})
+	return SearchResult[Playlist]{Total: min(result.Get("playlistCount").Int(), 100), Data: data}, nil
+}
+
+func (neteaseProvider) GetSongList(o SearchOption) (SearchResult[Music], error) {
+	client := neteaseClient()
+	detail, err := client.GetPlaylistDetail(o.ID)
+	if err != nil {
+		return SearchResult[Music]{}, err
+	}
+
+	var songIDs []string
+	detail.Get("playlist.trackIds").ForEach(func(_, tid gjson.Result) bool {
+		songIDs = append(songIDs, tid.Get("id").String())
+		return true
+	})
+
+	var data []*Music
+	const batchSize = 500
+	for i := 0; i < len(songIDs); i += batchSize {
+		end := i + batchSize
+		if end > len(songIDs) {
+			end = len(songIDs)
+		}
+		batch, err := client.GetSongDetail(songIDs[i:end])
+		if err != nil {
+			return SearchResult[Music]{}, err
+		}
+		batch.Get("songs").ForEach(func(_, item gjson.Result) bool {
+			data = append(data, parseNeteaseSong(item))
+			return true
+		})
+	}
+	return SearchResult[Music]{Total: int64(len(data)), Data: data}, nil
+}
+
+func (p neteaseProvider) GetMusic(id string) (*Track, error) {
 	client := neteaseClient()
 	result, err := client.GetSongDetail([]string{id})
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
 	song := result.Get("songs.0")
 	if !song.Exists() {
-		return nil
-	}
-
-	url, _ := client.GetDownloadURL(id)
-	lyric, _ := client.GetLyrics(id)
-
-	return H{
-		"type":       "music",
-		"url":        url,
-		"webUrl":     GenerateWebURL("wy", id),
-		"pictureUrl": song.Get("al.picUrl").String(),
-		"duration":   song.Get("dt").Int(),
-		"source":     "netease",
-		"lyric":      lyric,
-		"artist":     parseArtists(song),
-		"name":       song.Get("name").String(),
-		"album":      song.Get("al.name").String(),
-		"id":         id,
+		return nil, fmt.Errorf("%w: netease song %s", ErrNotFound, id)
+	}
+
+	url, err := p.GetStreamURL(id)
+	if err != nil {
+		return nil, err
+	}
+	lyric, _ := p.GetLyrics(id) // 没有歌词不影响播放
+
+	return &Track{
+		Type:       "music",
+		URL:        url,
+		WebURL:     p.WebURL(id),
+		PictureURL: song.Get("al.picUrl").String(),
+		Duration:   song.Get("dt").Int(),
+		Source:     "netease",
+		Lyric:      lyric,
+		Artist:     parseArtists(song),
+		Name:       song.Get("name").String(),
+		Album:      song.Get("al.name").String(),
+		ID:         id,
+		URLExpire:  time.Now().Add(neteaseURLTTL),
+	}, nil
+}
+
+func (neteaseProvider) GetStreamURL(id string) (string, error) {
+	return neteaseClient().GetDownloadURL(id)
+}
+
+func (neteaseProvider) GetLyrics(id string) (string, error) {
+	return neteaseClient().GetLyrics(id)
+}
+
+func (neteaseProvider) GetSimilar(id string) ([]string, error) {
+	result, err := neteaseClient().GetSimilarSongs(id)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	result.Get("songs").ForEach(func(_, v gjson.Result) bool {
+		ids = append(ids, v.Get("id").String())
+		return true
+	})
+	return ids, nil
+}
+
+func (neteaseProvider) WebURL(id string) string {
+	return fmt.Sprintf("https://music.163.com/#/song?id=%s", id)
+}
+
+func parseNeteaseSong(item gjson.Result) *Music {
+	return &Music{
+		ID:       item.Get("id").String(),
+		Name:     item.Get("name").String(),
+		Artist:   parseArtists(item),
+		Album:    item.Get("al.name").String(),
+		Duration: item.Get("dt").Int(),
+		Cover:    item.Get("al.picUrl").String(),
+		Source:   NetEase,
 	}
 }
 
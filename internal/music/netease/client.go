@@ -2,6 +2,7 @@ package netease
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/url"
 	"strings"
 	"time"
@@ -9,6 +10,7 @@ import (
 	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/tidwall/gjson"
 
+	"github.com/bihua-university/alisten/internal/music/types"
 	"github.com/bihua-university/alisten/internal/music/utils"
 )
 
@@ -134,3 +136,15 @@ func (n *Netease) GetSimilarSongs(songID string) (gjson.Result, error) {
 	}
 	return gjson.ParseBytes(body), nil
 }
+
+// apiError 将网易云接口返回的错误码转换为对应类别的错误
+func apiError(code int64) error {
+	switch code {
+	case 405, -460, -462: // 操作频繁或触发风控
+		return fmt.Errorf("%w: netease api error code: %d", types.ErrRateLimited, code)
+	case 404:
+		return fmt.Errorf("%w: netease api error code: %d", types.ErrNotFound, code)
+	default:
+		return fmt.Errorf("%w: netease api error code: %d", types.ErrUpstream, code)
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/tidwall/gjson"
 
+	"github.com/bihua-university/alisten/internal/music/types"
 	"github.com/bihua-university/alisten/internal/music/utils"
 )
 
@@ -21,6 +22,18 @@ func (n *Netease) GetDownloadURL(songID string) (string, error) {
 	return n.getWeapiDownloadURL(songID)
 }
 
+// unavailable 根据播放地址接口返回的歌曲信息判断无法播放的原因
+func unavailable(data gjson.Result) error {
+	switch fee := data.Get("fee").Int(); fee {
+	case 1, 4: // 1: VIP 歌曲, 4: 购买专辑
+		return fmt.Errorf("%w: netease song fee type %d", types.ErrVIP, fee)
+	}
+	if !data.Exists() {
+		return fmt.Errorf("%w: netease download url not found", types.ErrUpstream)
+	}
+	return fmt.Errorf("%w: netease download url not found, code %d", types.ErrCopyright, data.Get("code").Int())
+}
+
 func (n *Netease) tryEAPIQualities(songID string, qualities ...string) (string, error) {
 	for _, q := range qualities {
 		url, err := n.getEAPIDownloadURL(songID, q)
@@ -39,9 +52,10 @@ func (n *Netease) getWeapiDownloadURL(songID string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	url := gjson.ParseBytes(body).Get("data.0.url").String()
+	data := gjson.ParseBytes(body).Get("data.0")
+	url := data.Get("url").String()
 	if url == "" {
-		return "", errors.New("download url not found (might be vip or copyright restricted)")
+		return "", unavailable(data)
 	}
 	return url, nil
 }
@@ -70,9 +84,10 @@ func (n *Netease) getEAPIDownloadURL(songID, quality string) (string, error) {
 		return "", err
 	}
 
-	url := gjson.ParseBytes(body).Get("data.0.url").String()
+	data := gjson.ParseBytes(body).Get("data.0")
+	url := data.Get("url").String()
 	if url == "" {
-		return "", errors.New("eapi download url not found")
+		return "", unavailable(data)
 	}
 	return url, nil
 }
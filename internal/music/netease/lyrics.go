@@ -1,8 +1,6 @@
 package netease
 
 import (
-	"fmt"
-
 	"github.com/tidwall/gjson"
 )
 
@@ -20,7 +18,7 @@ func (n *Netease) GetLyrics(songID string) (string, error) {
 
 	result := gjson.ParseBytes(body)
 	if result.Get("code").Int() != 200 {
-		return "", fmt.Errorf("netease api error code: %d", result.Get("code").Int())
+		return "", apiError(result.Get("code").Int())
 	}
 	return result.Get("lrc.lyric").String(), nil
 }
@@ -2,7 +2,6 @@ package netease
 
 import (
 	"encoding/json"
-	"fmt"
 
 	"github.com/tidwall/gjson"
 )
@@ -19,7 +18,7 @@ func (n *Netease) GetPlaylistDetail(playlistID string) (gjson.Result, error) {
 	}
 	result := gjson.ParseBytes(body)
 	if result.Get("code").Int() != 200 {
-		return gjson.Result{}, fmt.Errorf("netease api error code: %d", result.Get("code").Int())
+		return gjson.Result{}, apiError(result.Get("code").Int())
 	}
 	return result, nil
 }
@@ -1,8 +1,6 @@
 package netease
 
 import (
-	"fmt"
-
 	"github.com/tidwall/gjson"
 )
 
@@ -14,7 +12,7 @@ func (n *Netease) Search(keyword string) (gjson.Result, error) {
 	}
 	result := gjson.ParseBytes(body)
 	if result.Get("code").Int() != 200 {
-		return gjson.Result{}, fmt.Errorf("netease api error code: %d", result.Get("code").Int())
+		return gjson.Result{}, apiError(result.Get("code").Int())
 	}
 	return result.Get("result"), nil
 }
@@ -27,7 +25,7 @@ func (n *Netease) SearchPlaylist(keyword string) (gjson.Result, error) {
 	}
 	result := gjson.ParseBytes(body)
 	if result.Get("code").Int() != 200 {
-		return gjson.Result{}, fmt.Errorf("netease api error code: %d", result.Get("code").Int())
+		return gjson.Result{}, apiError(result.Get("code").Int())
 	}
 	return result.Get("result"), nil
 }
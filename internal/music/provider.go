@@ -0,0 +1,94 @@
+package music
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Provider 音乐源
+//
+// 新的音乐源实现该接口后通过 Register 注册，不支持的操作返回 ErrNotSupported，
+// 可以嵌入 UnimplementedProvider 获得默认实现。
+type Provider interface {
+	// Search 搜索歌曲
+	Search(o SearchOption) (SearchResult[Music], error)
+	// SearchPlaylist 搜索歌单
+	SearchPlaylist(o SearchOption) (SearchResult[Playlist], error)
+	// GetSongList 获取歌单中的歌曲，歌单 ID 为 o.ID
+	GetSongList(o SearchOption) (SearchResult[Music], error)
+	// GetMusic 获取歌曲详情，包括播放地址和歌词
+	GetMusic(id string) (*Track, error)
+	// GetStreamURL 获取歌曲播放地址
+	GetStreamURL(id string) (string, error)
+	// GetLyrics 获取 LRC 格式歌词
+	GetLyrics(id string) (string, error)
+	// GetSimilar 获取相似歌曲的 ID
+	GetSimilar(id string) ([]string, error)
+	// WebURL 返回歌曲的网页地址
+	WebURL(id string) string
+}
+
+// UnimplementedProvider 所有操作都返回 ErrNotSupported
+type UnimplementedProvider struct{}
+
+func (UnimplementedProvider) Search(SearchOption) (SearchResult[Music], error) {
+	return SearchResult[Music]{}, ErrNotSupported
+}
+
+func (UnimplementedProvider) SearchPlaylist(SearchOption) (SearchResult[Playlist], error) {
+	return SearchResult[Playlist]{}, ErrNotSupported
+}
+
+func (UnimplementedProvider) GetSongList(SearchOption) (SearchResult[Music], error) {
+	return SearchResult[Music]{}, ErrNotSupported
+}
+
+func (UnimplementedProvider) GetMusic(string) (*Track, error) {
+	return nil, ErrNotSupported
+}
+
+func (UnimplementedProvider) GetStreamURL(string) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (UnimplementedProvider) GetLyrics(string) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (UnimplementedProvider) GetSimilar(string) ([]string, error) {
+	return nil, ErrNotSupported
+}
+
+func (UnimplementedProvider) WebURL(string) string {
+	return ""
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]Provider)
+)
+
+// Register 以 source 及其别名注册音乐源，重复注册会覆盖之前的音乐源
+func Register(p Provider, source string, aliases ...string) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[source] = p
+	for _, alias := range aliases {
+		providers[alias] = p
+	}
+}
+
+// GetProvider 返回 source 对应的音乐源，未注册时返回 nil
+func GetProvider(source string) Provider {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	return providers[source]
+}
+
+// provider 返回 source 对应的音乐源，未注册时返回 ErrNotSupported
+func provider(source string) (Provider, error) {
+	if p := GetProvider(source); p != nil {
+		return p, nil
+	}
+	return nil, fmt.Errorf("%w: unknown source %q", ErrNotSupported, source)
+}
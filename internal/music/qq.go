@@ -3,8 +3,6 @@ package music
 import (
 	"crypto/md5"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
@@ -13,22 +11,22 @@ import (
 	"github.com/tidwall/gjson"
 
 	"github.com/bihua-university/alisten/internal/music/qq"
+	"github.com/bihua-university/alisten/internal/music/utils"
 )
 
 var qqClient = qq.New()
 
-func post(u string, k url.Values) gjson.Result {
-	response, err := http.PostForm(u, k)
+func post(u string, k url.Values) (gjson.Result, error) {
+	body, err := utils.Post(u, strings.NewReader(k.Encode()),
+		utils.WithHeader("Content-Type", "application/x-www-form-urlencoded"),
+	)
 	if err != nil {
-		return gjson.Result{}
+		return gjson.Result{}, err
 	}
-	defer response.Body.Close()
-
-	all, err := io.ReadAll(response.Body)
-	if err != nil {
-		return gjson.Result{}
+	if !gjson.ValidBytes(body) {
+		return gjson.Result{}, fmt.Errorf("%w: invalid response from %s", ErrUpstream, u)
 	}
-	return gjson.ParseBytes(all)
+	return gjson.ParseBytes(body), nil
 }
 
 func crc(id string) string {
@@ -70,10 +68,75 @@ func GetQQMusicResult(r gjson.Result, o SearchOption) SearchResult[Music] {
 	return SearchResult[Music]{Total: idx, Data: data}
 }
 
-func getQQMusic(id string) H {
-	detail, _ := qqClient.GetSongDetail(id)
-	lyric, _ := qqClient.GetLyrics(id)
+func init() {
+	Register(qqProvider{}, "qq")
+}
+
+type qqProvider struct {
+	UnimplementedProvider
+}
+
+func (qqProvider) Search(o SearchOption) (SearchResult[Music], error) {
+	result, err := qqClient.Search(o.Keyword)
+	if err != nil {
+		return SearchResult[Music]{}, err
+	}
+	return GetQQMusicResult(result.Get("list"), o), nil
+}
+
+func (p qqProvider) GetMusic(id string) (*Track, error) {
+	detail, err := qqClient.GetSongDetail(id)
+	if err != nil {
+		return nil, err
+	}
+	if !detail.Exists() {
+		return nil, fmt.Errorf("%w: qq song %s", ErrNotFound, id)
+	}
+
+	artist := qqArtists(detail)
+	songName := detail.Get("name").String()
+	url, err := qqStreamURL(artist, songName)
+	if err != nil {
+		return nil, err
+	}
+	lyric, _ := p.GetLyrics(id) // 没有歌词不影响播放
+
+	ablumMid := detail.Get("album.mid").String()
+	picture := fmt.Sprintf("https://y.gtimg.cn/music/photo_new/T002R300x300M000%s.jpg", ablumMid)
+
+	return &Track{
+		Type:       "music",
+		URL:        url,
+		WebURL:     p.WebURL(id),
+		PictureURL: picture,
+		Duration:   detail.Get("interval").Int() * 1000,
+		Source:     "qq",
+		Lyric:      lyric,
+		Artist:     artist,
+		Name:       songName,
+		Album:      detail.Get("album.name").String(),
+		ID:         id,
+		URLExpire:  time.Now().Add(kuwoURLTTL),
+	}, nil
+}
 
+func (qqProvider) GetStreamURL(id string) (string, error) {
+	detail, err := qqClient.GetSongDetail(id)
+	if err != nil {
+		return "", err
+	}
+	return qqStreamURL(qqArtists(detail), detail.Get("name").String())
+}
+
+func (qqProvider) GetLyrics(id string) (string, error) {
+	return qqClient.GetLyrics(id)
+}
+
+func (qqProvider) WebURL(id string) string {
+	return fmt.Sprintf("https://y.qq.com/n/ryqq/songDetail/%s", id)
+}
+
+func qqArtists(detail gjson.Result) string {
 	artist := ""
 	detail.Get("singer").ForEach(func(_, value gjson.Result) bool {
 		if artist != "" {
@@ -82,10 +145,13 @@ func getQQMusic(id string) H {
 		artist += value.Get("name").String()
 		return true
 	})
+	return artist
+}
 
-	songName := detail.Get("name").String()
+// qqStreamURL QQ 音乐没有可用的播放地址，通过歌手和歌名在酷我上查找同一首歌
+func qqStreamURL(artist, songName string) (string, error) {
 	key := artist + " " + songName
-	search := post("https://music.gdstudio.org/api.php", url.Values{
+	search, err := post("https://music.gdstudio.org/api.php", url.Values{
 		"types":  []string{"search"},
 		"source": []string{"kuwo"},
 		"name":   []string{key},
@@ -93,36 +159,36 @@ func getQQMusic(id string) H {
 		"count":  []string{"20"},
 		"s":      []string{crc(key)},
 	})
+	if err != nil {
+		return "", err
+	}
 
 	rid := search.Get("0.id").String()
-	download := post("https://music.gdstudio.org/api.php", url.Values{
+	if rid == "" {
+		return "", fmt.Errorf("%w: no stream found for %q", ErrCopyright, key)
+	}
+	download, err := post("https://music.gdstudio.org/api.php", url.Values{
 		"types":  []string{"url"},
 		"source": []string{"kuwo"},
 		"id":     []string{rid},
 		"br":     []string{"320"},
 		"s":      []string{crc(rid)},
 	})
-
-	ablumMid := detail.Get("album.mid").String()
-	picture := fmt.Sprintf("https://y.gtimg.cn/music/photo_new/T002R300x300M000%s.jpg", ablumMid)
-
-	return H{
-		"type":       "music",
-		"url":        download.Get("url").String(),
-		"webUrl":     GenerateWebURL("qq", id),
-		"pictureUrl": picture,
-		"duration":   detail.Get("interval").Int() * 1000,
-		"source":     "qq",
-		"lyric":      lyric,
-		"artist":     artist,
-		"name":       songName,
-		"album":      detail.Get("album.name").String(),
-		"id":         id,
+	if err != nil {
+		return "", err
+	}
+	u := download.Get("url").String()
+	if u == "" {
+		return "", fmt.Errorf("%w: no stream found for %q", ErrCopyright, key)
 	}
+	return u, nil
 }
 
-func searchQQPlaylist(o SearchOption) SearchResult[Playlist] {
-	result, _ := qqClient.SearchPlaylist(o.Keyword)
+func (qqProvider) SearchPlaylist(o SearchOption) (SearchResult[Playlist], error) {
+	result, err := qqClient.SearchPlaylist(o.Keyword)
+	if err != nil {
+		return SearchResult[Playlist]{}, err
+	}
 
 	start := (o.Page - 1) * o.PageSize
 	end := start + o.PageSize
@@ -149,5 +215,5 @@ func searchQQPlaylist(o SearchOption) SearchResult[Playlist] {
 		idx++
 		return true
 	})
-	return SearchResult[Playlist]{Total: idx, Data: data}
+	return SearchResult[Playlist]{Total: idx, Data: data}, nil
 }
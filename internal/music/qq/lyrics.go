@@ -2,12 +2,12 @@ package qq
 
 import (
 	"encoding/base64"
-	"errors"
 	"fmt"
 	"net/url"
 
 	"github.com/tidwall/gjson"
 
+	"github.com/bihua-university/alisten/internal/music/types"
 	"github.com/bihua-university/alisten/internal/music/utils"
 )
 
@@ -37,7 +37,7 @@ func (q *QQ) GetLyrics(songMID string) (string, error) {
 	result := gjson.ParseBytes(unwrapJSONP(body))
 	lyric := result.Get("lyric").String()
 	if lyric == "" {
-		return "", errors.New("lyric is empty or not found")
+		return "", fmt.Errorf("%w: qq lyric is empty", types.ErrNotFound)
 	}
 
 	decodedBytes, err := base64.StdEncoding.DecodeString(lyric)
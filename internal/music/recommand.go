@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/hashicorp/golang-lru/v2/expirable"
-	"github.com/tidwall/gjson"
 )
 
 type NeteaseMusicRecommander struct {
@@ -110,20 +109,15 @@ func (mr *NeteaseMusicRecommander) Recommend(playlist []string) []string {
 			return
 		}
 
-		client := neteaseClient()
-		result, err := client.GetSimilarSongs(id)
+		recommend, err := GetProvider("wy").GetSimilar(id)
 		if err != nil {
 			return
 		}
-		recommend := make([]string, 0, 5)
-		result.Get("songs").ForEach(func(_, v gjson.Result) bool {
-			sid := v.Get("id").String()
-			recommend = append(recommend, sid)
+		for _, sid := range recommend {
 			if _, ok := visit[sid]; !ok { // don't recommend existed music
 				item[sid] = struct{}{}
 			}
-			return true
-		})
+		}
 		mr.cache.Add(id, recommend)
 	}
 
@@ -0,0 +1,41 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// 音乐源错误的类别，具体错误通过 fmt.Errorf("%w: ...", ErrXxx) 包装，
+// 调用方使用 errors.Is 判断类别。
+var (
+	ErrUpstream     = errors.New("upstream unavailable")
+	ErrCopyright    = errors.New("copyright restricted")
+	ErrVIP          = errors.New("vip only")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrTimeout      = errors.New("timeout")
+	ErrNotFound     = errors.New("not found")
+	ErrNotSupported = errors.New("operation not supported by source")
+)
+
+var kinds = []error{ErrCopyright, ErrVIP, ErrRateLimited, ErrTimeout, ErrNotFound, ErrNotSupported, ErrUpstream}
+
+// Kind 返回错误所属的类别，无法识别的错误视为 ErrUpstream，err 为 nil 时返回 nil
+func Kind(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, k := range kinds {
+		if errors.Is(err, k) {
+			return k
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return ErrTimeout
+	}
+	return ErrUpstream
+}
@@ -0,0 +1,28 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKind(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want error
+	}{
+		{nil, nil},
+		{fmt.Errorf("%w: song 1", ErrVIP), ErrVIP},
+		{fmt.Errorf("wy: %w", fmt.Errorf("%w: code 404", ErrCopyright)), ErrCopyright},
+		{fmt.Errorf("%w: %w", ErrTimeout, context.DeadlineExceeded), ErrTimeout},
+		{context.DeadlineExceeded, ErrTimeout},
+		{errors.New("connection refused"), ErrUpstream},
+	}
+
+	for _, tc := range testCases {
+		if got := Kind(tc.err); got != tc.want {
+			t.Errorf("Kind(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package types
 
+import "time"
+
 type Source int
 
 const (
 	QQ Source = iota
 	NetEase
 	KuWo
+	Local
 )
 
 func (s Source) String() string {
@@ -16,6 +19,8 @@ func (s Source) String() string {
 		return "netease"
 	case KuWo:
 		return "kuwo"
+	case Local:
+		return "local"
 	default:
 		return "unknown"
 	}
@@ -41,3 +46,28 @@ type Playlist struct {
 	PlayCount  int64  `json:"playCount"`
 	SongCount  int64  `json:"songCount"`
 }
+
+// Track 可播放的歌曲，包含播放地址和歌词
+//
+// 字段按 json 名称的字母序排列，与之前 map 序列化的输出保持一致。
+type Track struct {
+	Album      string `json:"album"`
+	Artist     string `json:"artist"` // 多个艺术家以 ", " 分隔
+	Duration   int64  `json:"duration"`
+	ID         string `json:"id"`
+	Lyric      string `json:"lyric"`
+	Name       string `json:"name"`
+	PictureURL string `json:"pictureUrl"`
+	Source     string `json:"source"`
+	Type       string `json:"type"`
+	URL        string `json:"url"`
+	WebURL     string `json:"webUrl"`
+
+	// URLExpire 播放地址的过期时间，零值表示不过期
+	URLExpire time.Time `json:"-"`
+}
+
+// Expired 播放地址是否已经过期
+func (t *Track) Expired() bool {
+	return !t.URLExpire.IsZero() && time.Now().After(t.URLExpire)
+}
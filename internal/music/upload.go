@@ -0,0 +1,68 @@
+package music
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/bihua-university/alisten/internal/music/upload"
+)
+
+// UploadSource 用户上传的音乐源
+const UploadSource = "upload"
+
+var uploadLibrary atomic.Pointer[upload.Library]
+
+// SetUploadLibrary 设置上传曲库，nil 表示不启用上传
+func SetUploadLibrary(l *upload.Library) {
+	uploadLibrary.Store(l)
+}
+
+// UploadLibrary 返回上传曲库，未启用时返回 nil
+func UploadLibrary() *upload.Library {
+	return uploadLibrary.Load()
+}
+
+func init() {
+	Register(uploadProvider{}, UploadSource)
+}
+
+// uploadProvider 用户上传的音乐，只能在上传所在的房间点播，不支持搜索
+type uploadProvider struct {
+	UnimplementedProvider
+}
+
+func (uploadProvider) GetMusic(id string) (*Track, error) {
+	l := uploadLibrary.Load()
+	if l == nil {
+		return nil, fmt.Errorf("%w: upload is not enabled", ErrNotSupported)
+	}
+	t, err := l.Get(id)
+	if err != nil {
+		if errors.Is(err, upload.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
+		return nil, err
+	}
+	u, expires := l.StreamURL(id)
+	return &Track{
+		Album:      t.Album,
+		Artist:     t.Artist,
+		Duration:   t.Duration,
+		ID:         id,
+		Name:       t.Name,
+		PictureURL: l.CoverURL(id),
+		Source:     UploadSource,
+		Type:       "music",
+		URL:        u,
+		URLExpire:  expires.Add(-localURLMargin),
+	}, nil
+}
+
+func (p uploadProvider) GetStreamURL(id string) (string, error) {
+	t, err := p.GetMusic(id)
+	if err != nil {
+		return "", err
+	}
+	return t.URL, nil
+}
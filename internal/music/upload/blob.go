@@ -0,0 +1,111 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Blob 上传文件的存储后端，key 不包含路径分隔符
+//
+// 默认使用 DirBlob 保存在本地目录，其他后端（例如对象存储）实现该接口即可替换。
+type Blob interface {
+	// Put 保存文件，已存在则覆盖
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open 打开文件，需要支持 Seek 以响应 Range 请求
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete 删除文件，文件不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// List 列出所有文件的 key
+	List(ctx context.Context) ([]string, error)
+}
+
+// tempPrefix DirBlob 写入中的临时文件前缀
+const tempPrefix = ".tmp-"
+
+// DirBlob 将文件保存在本地目录
+type DirBlob struct {
+	dir string
+}
+
+// NewDirBlob 使用目录 dir 保存文件，目录不存在时创建，并清理上次未写完的临时文件
+func NewDirBlob(dir string) (*DirBlob, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), tempPrefix) {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+	return &DirBlob{dir: dir}, nil
+}
+
+func (b *DirBlob) path(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || !filepath.IsLocal(key) || strings.HasPrefix(key, tempPrefix) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(b.dir, key), nil
+}
+
+// Put 先写入临时文件再重命名，写入失败不会留下不完整的文件
+func (b *DirBlob) Put(_ context.Context, key string, r io.Reader) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(b.dir, tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func (b *DirBlob) Open(_ context.Context, key string) (io.ReadSeekCloser, error) {
+	p, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (b *DirBlob) Delete(_ context.Context, key string) error {
+	p, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (b *DirBlob) List(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), tempPrefix) {
+			keys = append(keys, e.Name())
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,302 @@
+// Package upload 保存用户上传的音乐，并通过签名的限时地址提供播放
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bihua-university/alisten/internal/audio"
+	"github.com/bihua-university/alisten/internal/auth"
+	"github.com/bihua-university/alisten/internal/music/local"
+)
+
+// 上传音乐的 HTTP 接口路径
+const (
+	StreamPath = "/music/upload/stream"
+	CoverPath  = "/music/upload/cover"
+)
+
+// ErrNotFound 上传的歌曲不存在或已被清理
+var ErrNotFound = errors.New("upload not found")
+
+// Track 一首上传的歌曲，元数据以 <ID>.json 与音频 <ID>.<Format> 一起保存在 Blob 中
+type Track struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Artist   string    `json:"artist"`
+	Album    string    `json:"album"`
+	Duration int64     `json:"duration"` // 毫秒
+	Format   string    `json:"format"`
+	Size     int64     `json:"size"`
+	Cover    bool      `json:"cover"` // 是否有内嵌封面
+	House    string    `json:"house"` // 上传所在的房间，只能在该房间点播
+	User     auth.User `json:"user"`  // 上传者
+	Created  int64     `json:"created"`
+}
+
+func (t *Track) audioKey() string { return t.ID + "." + t.Format }
+func (t *Track) metaKey() string  { return t.ID + ".json" }
+
+// Library 上传的歌曲，Load 之后可以并发使用
+type Library struct {
+	blob    Blob
+	signer  *local.Signer
+	baseURL string // 播放地址的前缀，为空时生成相对地址
+
+	mu      sync.RWMutex
+	tracks  map[string]*Track
+	pending map[string]bool // 正在写入的歌曲，清理时跳过
+}
+
+// New 创建使用 blob 存储的上传曲库，需要调用 Load 读取已上传的歌曲
+//
+// 播放地址使用 key 签名，baseURL 为服务器对外的地址。
+func New(blob Blob, key []byte, baseURL string) *Library {
+	return &Library{
+		blob:    blob,
+		signer:  local.NewSigner(key),
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		tracks:  make(map[string]*Track),
+		pending: make(map[string]bool),
+	}
+}
+
+// Load 读取 Blob 中已上传歌曲的元数据
+func (l *Library) Load(ctx context.Context) error {
+	keys, err := l.blob.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list uploads: %w", err)
+	}
+	tracks := make(map[string]*Track)
+	for _, key := range keys {
+		if path.Ext(key) != ".json" {
+			continue
+		}
+		t, err := l.readMeta(ctx, key)
+		if err != nil {
+			slog.Warn("skip upload", "key", key, "error", err)
+			continue
+		}
+		tracks[t.ID] = t
+	}
+	l.mu.Lock()
+	l.tracks = tracks
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *Library) readMeta(ctx context.Context, key string) (*Track, error) {
+	f, err := l.blob.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var t Track
+	if err := json.NewDecoder(f).Decode(&t); err != nil {
+		return nil, err
+	}
+	if t.ID == "" || t.metaKey() != key {
+		return nil, errors.New("metadata does not match key")
+	}
+	return &t, nil
+}
+
+// Len 返回上传的歌曲数
+func (l *Library) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.tracks)
+}
+
+// Get 返回 id 对应的歌曲
+func (l *Library) Get(id string) (*Track, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if t := l.tracks[id]; t != nil {
+		return t, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// Add 保存上传的音频，info 为 audio.Probe 的结果，没有标题时以文件名作为歌名
+func (l *Library) Add(ctx context.Context, r io.ReadSeeker, info *audio.Info, filename, house string, user auth.User) (*Track, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	t := &Track{
+		ID:       uuid.NewString(),
+		Name:     info.Title,
+		Artist:   info.Artist,
+		Album:    info.Album,
+		Duration: info.Duration,
+		Format:   info.Format,
+		Size:     size,
+		Cover:    info.Picture != nil,
+		House:    house,
+		User:     user,
+		Created:  time.Now().UnixMilli(),
+	}
+	if t.Name == "" {
+		base := path.Base(strings.ReplaceAll(filename, `\`, "/"))
+		t.Name = strings.TrimSuffix(base, path.Ext(base))
+	}
+	meta, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.pending[t.ID] = true
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		delete(l.pending, t.ID)
+		l.mu.Unlock()
+	}()
+
+	// 先写音频再写元数据，只有音频的 key 会被清理
+	if err := l.blob.Put(ctx, t.audioKey(), r); err != nil {
+		return nil, fmt.Errorf("save upload: %w", err)
+	}
+	if err := l.blob.Put(ctx, t.metaKey(), bytes.NewReader(meta)); err != nil {
+		l.blob.Delete(ctx, t.audioKey())
+		return nil, fmt.Errorf("save upload: %w", err)
+	}
+
+	l.mu.Lock()
+	l.tracks[t.ID] = t
+	l.mu.Unlock()
+	return t, nil
+}
+
+// GC 删除上传超过 grace 且 referenced 中没有的歌曲，以及没有元数据的文件，返回删除的歌曲数
+func (l *Library) GC(ctx context.Context, referenced map[string]bool, grace time.Duration) (int, error) {
+	keys, err := l.blob.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list uploads: %w", err)
+	}
+
+	deadline := time.Now().Add(-grace).UnixMilli()
+	var remove []string
+	deleted := 0
+	l.mu.Lock()
+	for _, key := range keys {
+		id := strings.TrimSuffix(key, path.Ext(key))
+		if l.pending[id] {
+			continue
+		}
+		if l.tracks[id] == nil {
+			remove = append(remove, key)
+		}
+	}
+	for id, t := range l.tracks {
+		if !referenced[id] && t.Created < deadline {
+			delete(l.tracks, id)
+			remove = append(remove, t.audioKey(), t.metaKey())
+			deleted++
+		}
+	}
+	l.mu.Unlock()
+
+	var errs []error
+	for _, key := range remove {
+		if err := l.blob.Delete(ctx, key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// StreamURL 返回歌曲的签名播放地址和过期时间
+func (l *Library) StreamURL(id string) (string, time.Time) {
+	expires := time.Now().Add(local.URLTTL)
+	return l.baseURL + StreamPath + "?" + l.signer.Sign("stream", id, expires).Encode(), expires
+}
+
+// CoverURL 返回歌曲封面的签名地址，没有封面时返回空字符串
+func (l *Library) CoverURL(id string) string {
+	t, err := l.Get(id)
+	if err != nil || !t.Cover {
+		return ""
+	}
+	return l.baseURL + CoverPath + "?" + l.signer.Sign("cover", id, time.Now().Add(local.URLTTL)).Encode()
+}
+
+// ServeStream 提供签名地址对应的音频，支持 Range 请求
+func (l *Library) ServeStream(w http.ResponseWriter, r *http.Request) {
+	t, ok := l.verify(w, r, "stream")
+	if !ok {
+		return
+	}
+	f, err := l.blob.Open(r.Context(), t.audioKey())
+	if err != nil {
+		slog.Warn("open upload", "id", t.ID, "error", err)
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", audio.MIMEType(t.Format))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, "", time.UnixMilli(t.Created), f)
+}
+
+// ServeCover 提供签名地址对应的内嵌封面
+func (l *Library) ServeCover(w http.ResponseWriter, r *http.Request) {
+	t, ok := l.verify(w, r, "cover")
+	if !ok {
+		return
+	}
+	f, err := l.blob.Open(r.Context(), t.audioKey())
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := audio.Probe(f)
+	if err != nil || info.Picture == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if info.Picture.MIMEType != "" {
+		w.Header().Set("Content-Type", info.Picture.MIMEType)
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, "", time.UnixMilli(t.Created), bytes.NewReader(info.Picture.Data))
+}
+
+// verify 检查请求的签名，失败时写入错误响应
+func (l *Library) verify(w http.ResponseWriter, r *http.Request, kind string) (*Track, bool) {
+	id, err := l.signer.Verify(kind, r.URL.Query())
+	switch {
+	case errors.Is(err, local.ErrExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+		return nil, false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, false
+	}
+	t, err := l.Get(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return t, true
+}
@@ -0,0 +1,67 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/audio"
+	"github.com/bihua-university/alisten/internal/auth"
+)
+
+func TestLibrary(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, tempPrefix+"partial"), []byte("x"), 0o644)
+	blob, err := NewDirBlob(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, tempPrefix+"partial")); !os.IsNotExist(err) {
+		t.Errorf("NewDirBlob() did not remove temp file")
+	}
+
+	l := New(blob, []byte("key"), "")
+	info := &audio.Info{Format: audio.MP3, Duration: 1000}
+	user := auth.User{ID: "u1", Name: "alice"}
+	a, err := l.Add(ctx, bytes.NewReader([]byte("audio a")), info, `C:\music\Song A.mp3`, "h1", user)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if a.Name != "Song A" || a.Size != 7 || a.House != "h1" {
+		t.Errorf("Add() = %+v, want Song A of 7 bytes in h1", a)
+	}
+	b, err := l.Add(ctx, bytes.NewReader([]byte("audio b")), info, "b.mp3", "h1", user)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	// 没有元数据的文件
+	blob.Put(ctx, "orphan.mp3", bytes.NewReader([]byte("orphan")))
+
+	// 重新加载后保留已上传的歌曲
+	l = New(blob, []byte("key"), "")
+	if err := l.Load(ctx); err != nil || l.Len() != 2 {
+		t.Fatalf("Load() = %d tracks, %v, want 2", l.Len(), err)
+	}
+
+	// 上传不久的歌曲不会被清理
+	if n, err := l.GC(ctx, nil, time.Hour); err != nil || n != 0 {
+		t.Errorf("GC(grace) = %d, %v, want 0", n, err)
+	}
+	if n, err := l.GC(ctx, map[string]bool{a.ID: true}, -time.Second); err != nil || n != 1 {
+		t.Errorf("GC() = %d, %v, want 1", n, err)
+	}
+	if _, err := l.Get(b.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(collected) error = %v, want ErrNotFound", err)
+	}
+	keys, _ := blob.List(ctx)
+	slices.Sort(keys)
+	if want := []string{a.ID + ".json", a.ID + ".mp3"}; !slices.Equal(keys, want) {
+		t.Errorf("keys after GC = %v, want %v", keys, want)
+	}
+}
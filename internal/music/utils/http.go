@@ -5,8 +5,14 @@ import (
 	"io"
 	"math/rand"
 	"net/http"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/music/types"
 )
 
+// client 请求音乐源使用的 HTTP 客户端
+var client = &http.Client{Timeout: 15 * time.Second}
+
 // RequestOption 是 HTTP 请求的选项函数
 type RequestOption func(*http.Request)
 
@@ -50,15 +56,7 @@ func Get(apiURL string, opts ...RequestOption) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	for _, opt := range opts {
-		opt(req)
-	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	return io.ReadAll(resp.Body)
+	return do(req, opts)
 }
 
 // Post 发送 POST 请求并返回响应体
@@ -67,13 +65,25 @@ func Post(apiURL string, body io.Reader, opts ...RequestOption) ([]byte, error)
 	if err != nil {
 		return nil, err
 	}
+	return do(req, opts)
+}
+
+// do 发送请求，网络错误和异常状态码会包装为对应的错误类别
+func do(req *http.Request, opts []RequestOption) ([]byte, error) {
 	for _, opt := range opts {
 		opt(req)
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", types.Kind(err), err)
 	}
 	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, fmt.Errorf("%w: %s %s", types.ErrRateLimited, req.Host, resp.Status)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, fmt.Errorf("%w: %s %s", types.ErrUpstream, req.Host, resp.Status)
+	}
 	return io.ReadAll(resp.Body)
 }
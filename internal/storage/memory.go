@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/bihua-university/alisten/internal/auth"
+)
+
+// Memory 内存存储，进程退出后数据丢失，主要用于测试和未配置数据库的部署
+type Memory struct {
+	mu       sync.Mutex
+	houses   map[string][]byte
+	accounts map[string]auth.Account // id -> account
+}
+
+// NewMemory 创建内存存储
+func NewMemory() *Memory {
+	return &Memory{
+		houses:   make(map[string][]byte),
+		accounts: make(map[string]auth.Account),
+	}
+}
+
+func (m *Memory) LoadHouses(_ context.Context) ([]*House, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]string, 0, len(m.houses))
+	for id := range m.houses {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	list := make([]*House, 0, len(ids))
+	for _, id := range ids {
+		// 存储序列化后的数据，避免调用方修改已保存的状态
+		var h House
+		if err := json.Unmarshal(m.houses[id], &h); err != nil {
+			return nil, err
+		}
+		list = append(list, &h)
+	}
+	return list, nil
+}
+
+func (m *Memory) SaveHouse(_ context.Context, h *House) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.houses[h.ID] = b
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) DeleteHouse(_ context.Context, id string) error {
+	m.mu.Lock()
+	delete(m.houses, id)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) CreateAccount(_ context.Context, a *auth.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.accounts {
+		if e.Name == a.Name {
+			return auth.ErrAccountExists
+		}
+	}
+	m.accounts[a.ID] = *a
+	return nil
+}
+
+func (m *Memory) GetAccount(_ context.Context, id string) (*auth.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[id]
+	if !ok {
+		return nil, auth.ErrAccountNotFound
+	}
+	return &a, nil
+}
+
+func (m *Memory) GetAccountByName(_ context.Context, name string) (*auth.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range m.accounts {
+		if a.Name == name {
+			return &a, nil
+		}
+	}
+	return nil, auth.ErrAccountNotFound
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bihua-university/alisten/internal/auth"
+)
+
+func TestMemorySaveLoad(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+
+	h := &House{
+		ID:       "room",
+		Name:     "音乐房间",
+		Mode:     1,
+		Current:  &Order{Source: "wy", ID: "1", User: auth.User{Name: "a"}},
+		Playlist: []Order{{Source: "qq", ID: "2", Likes: 3}},
+	}
+	if err := m.SaveHouse(ctx, h); err != nil {
+		t.Fatalf("SaveHouse() error = %v", err)
+	}
+	// 修改调用方的数据不应影响已保存的状态
+	h.Playlist[0].Likes = 10
+
+	list, err := m.LoadHouses(ctx)
+	if err != nil {
+		t.Fatalf("LoadHouses() error = %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("LoadHouses() returned %d houses, want 1", len(list))
+	}
+	got := list[0]
+	if got.Name != "音乐房间" || got.Mode != 1 || got.Current == nil || got.Current.ID != "1" {
+		t.Errorf("LoadHouses() = %+v", got)
+	}
+	if len(got.Playlist) != 1 || got.Playlist[0].Likes != 3 {
+		t.Errorf("Playlist = %+v, want likes 3", got.Playlist)
+	}
+}
+
+func TestMemoryDelete(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+
+	m.SaveHouse(ctx, &House{ID: "a"})
+	m.SaveHouse(ctx, &House{ID: "b"})
+	if err := m.DeleteHouse(ctx, "a"); err != nil {
+		t.Fatalf("DeleteHouse() error = %v", err)
+	}
+	if err := m.DeleteHouse(ctx, "missing"); err != nil {
+		t.Errorf("DeleteHouse() on missing house error = %v", err)
+	}
+
+	list, _ := m.LoadHouses(ctx)
+	if len(list) != 1 || list[0].ID != "b" {
+		t.Errorf("LoadHouses() = %+v, want only b", list)
+	}
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/bihua-university/alisten/internal/auth"
+)
+
+// uniqueViolation PostgreSQL 唯一约束冲突的错误码
+const uniqueViolation = "23505"
+
+const createTableSQL = `
+CREATE TABLE IF NOT EXISTS alisten_house (
+	id         TEXT PRIMARY KEY,
+	state      JSONB NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS alisten_account (
+	id            TEXT PRIMARY KEY,
+	name          TEXT NOT NULL UNIQUE,
+	email         TEXT NOT NULL DEFAULT '',
+	password_hash BYTEA NOT NULL,
+	created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// Pgsql PostgreSQL 存储，房间状态以 JSONB 形式保存在 alisten_house 表中，账号保存在 alisten_account 表中
+type Pgsql struct {
+	db *sql.DB
+}
+
+// OpenPgsql 连接 PostgreSQL 并自动建表
+func OpenPgsql(dsn string) (*Pgsql, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	}
+	if _, err := db.Exec(createTableSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化数据表失败: %w", err)
+	}
+	return &Pgsql{db: db}, nil
+}
+
+func (p *Pgsql) LoadHouses(ctx context.Context) ([]*House, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT state FROM alisten_house ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*House
+	for rows.Next() {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			return nil, err
+		}
+		var h House
+		if err := json.Unmarshal(b, &h); err != nil {
+			return nil, err
+		}
+		list = append(list, &h)
+	}
+	return list, rows.Err()
+}
+
+func (p *Pgsql) SaveHouse(ctx context.Context, h *House) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `
+INSERT INTO alisten_house (id, state, updated_at) VALUES ($1, $2, now())
+ON CONFLICT (id) DO UPDATE SET state = EXCLUDED.state, updated_at = EXCLUDED.updated_at`,
+		h.ID, b)
+	return err
+}
+
+func (p *Pgsql) DeleteHouse(ctx context.Context, id string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM alisten_house WHERE id = $1`, id)
+	return err
+}
+
+func (p *Pgsql) CreateAccount(ctx context.Context, a *auth.Account) error {
+	_, err := p.db.ExecContext(ctx, `
+INSERT INTO alisten_account (id, name, email, password_hash, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		a.ID, a.Name, a.Email, a.PasswordHash, a.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return auth.ErrAccountExists
+	}
+	return err
+}
+
+func (p *Pgsql) GetAccount(ctx context.Context, id string) (*auth.Account, error) {
+	return p.getAccount(ctx, `WHERE id = $1`, id)
+}
+
+func (p *Pgsql) GetAccountByName(ctx context.Context, name string) (*auth.Account, error) {
+	return p.getAccount(ctx, `WHERE name = $1`, name)
+}
+
+func (p *Pgsql) getAccount(ctx context.Context, where string, arg any) (*auth.Account, error) {
+	var a auth.Account
+	err := p.db.QueryRowContext(ctx,
+		`SELECT id, name, email, password_hash, created_at FROM alisten_account `+where, arg,
+	).Scan(&a.ID, &a.Name, &a.Email, &a.PasswordHash, &a.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, auth.ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (p *Pgsql) Close() error {
+	return p.db.Close()
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/bihua-university/alisten/internal/auth"
+	"github.com/bihua-university/alisten/internal/base"
+)
+
+// Order 播放列表中的一首点歌
+type Order struct {
+	Source string    `json:"source"`
+	ID     string    `json:"id"`
+	User   auth.User `json:"user"`
+	Guest  string    `json:"guest,omitempty"` // 点歌游客的标识，用于区分游客
+	Likes  int       `json:"likes"`
+}
+
+// Restriction 对用户或 IP 的封禁、禁言
+type Restriction struct {
+	UserID string `json:"userId,omitempty"` // 账号 ID
+	IP     string `json:"ip,omitempty"`     // 打码后的 IP
+	Until  int64  `json:"until,omitempty"`  // 截止时间（毫秒），0 表示永久
+}
+
+// History 一条播放历史
+type History struct {
+	Order
+	Start  int64 `json:"start"`  // 开始播放的时间（毫秒）
+	Reason int   `json:"reason"` // 结束播放的原因
+}
+
+// House 房间的持久化状态
+type House struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	Desc       string      `json:"desc"`
+	Password   string      `json:"password"`
+	Owner      string      `json:"owner,omitempty"`      // 房主的账号 ID
+	Moderators []string    `json:"moderators,omitempty"` // 房管的账号 ID
+	Ultimate   bool        `json:"ultimate"`
+	Limits     base.Limits `json:"limits"`
+	Mode       int         `json:"mode"`
+	Current    *Order      `json:"current,omitempty"`
+	PushTime   int64       `json:"pushTime"` // 当前歌曲开始播放的时间（毫秒）
+	End        int64       `json:"end"`      // 当前歌曲结束的时间（毫秒）
+	Playlist   []Order     `json:"playlist"`
+
+	Bans  []Restriction `json:"bans,omitempty"`
+	Mutes []Restriction `json:"mutes,omitempty"`
+
+	History []History `json:"history,omitempty"`
+}
+
+// Store 房间状态和账号存储
+type Store interface {
+	auth.AccountStore
+
+	// LoadHouses 读取所有已保存的房间
+	LoadHouses(ctx context.Context) ([]*House, error)
+	// SaveHouse 保存房间状态，已存在则覆盖
+	SaveHouse(ctx context.Context, h *House) error
+	// DeleteHouse 删除房间，房间不存在时不返回错误
+	DeleteHouse(ctx context.Context, id string) error
+	// Close 释放存储占用的资源
+	Close() error
+}
+
+// Open 根据连接串打开存储，连接串为空时使用内存存储
+func Open(dsn string) (Store, error) {
+	if dsn == "" {
+		return NewMemory(), nil
+	}
+	return OpenPgsql(dsn)
+}
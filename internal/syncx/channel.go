@@ -1,8 +1,11 @@
 package syncx
 
+import "sync/atomic"
+
 type UnboundedChan[T any] struct {
 	in  chan<- T
 	out <-chan T
+	n   *atomic.Int64 // 缓冲区中的元素个数
 }
 
 func (c *UnboundedChan[T]) In() chan<- T {
@@ -13,9 +16,15 @@ func (c *UnboundedChan[T]) Out() <-chan T {
 	return c.out
 }
 
+// Len 返回尚未被取出的元素个数，包括 in、out 和内部缓冲区中的元素
+func (c *UnboundedChan[T]) Len() int {
+	return len(c.in) + int(c.n.Load()) + len(c.out)
+}
+
 func NewUnboundedChan[T any](capacity int) UnboundedChan[T] {
 	in := make(chan T, capacity)
 	out := make(chan T, capacity)
+	n := new(atomic.Int64)
 
 	// spawn background loop
 	go func() {
@@ -38,6 +47,7 @@ func NewUnboundedChan[T any](capacity int) UnboundedChan[T] {
 
 			// out is full, put val in buffer
 			buffer = append(buffer, val)
+			n.Add(1)
 			for len(buffer) > 0 {
 				select {
 				case val, ok := <-in:
@@ -45,8 +55,10 @@ func NewUnboundedChan[T any](capacity int) UnboundedChan[T] {
 						break forward
 					}
 					buffer = append(buffer, val)
+					n.Add(1)
 				case out <- buffer[0]:
 					buffer = buffer[1:]
+					n.Add(-1)
 					if len(buffer) == 0 {
 						// make a new buffer to avoid memory leak
 						buffer = make([]T, 0, capacity)
@@ -59,8 +71,9 @@ func NewUnboundedChan[T any](capacity int) UnboundedChan[T] {
 		for len(buffer) > 0 {
 			out <- buffer[0]
 			buffer = buffer[1:]
+			n.Add(-1)
 		}
 	}()
 
-	return UnboundedChan[T]{in: in, out: out}
+	return UnboundedChan[T]{in: in, out: out, n: n}
 }
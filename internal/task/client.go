@@ -9,12 +9,18 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
 	"time"
 )
 
 type Client struct {
 	ServerURL   string
-	Token       string // 鉴权Token
+	ID          string   // worker ID，服务器用来区分不同的 worker
+	Token       string   // 鉴权Token
+	Types       []string // 支持的任务类型，为空表示接受任意类型
+	Lease       bool     // 为 true 时领取的任务有租约，需要定期调用 Heartbeat 续约
 	PollTimeout time.Duration
 	HTTPClient  *http.Client
 }
@@ -22,8 +28,10 @@ type Client struct {
 // NewClient 创建新的长轮询客户端
 func NewClient(serverURL, token string) *Client {
 	certPool := x509.NewCertPool()
+	hostname, _ := os.Hostname()
 	return &Client{
 		ServerURL:   serverURL,
+		ID:          fmt.Sprintf("%s-%d", hostname, os.Getpid()),
 		Token:       token,
 		PollTimeout: 30 * time.Second, // 30秒超时
 		HTTPClient: &http.Client{
@@ -39,15 +47,28 @@ func NewClient(serverURL, token string) *Client {
 }
 
 func (c *Client) setHeader(req *http.Request) {
+	c.fillHeader(req.Header)
+}
+
+func (c *Client) fillHeader(h http.Header) {
 	if c.Token != "" {
-		req.Header.Set("Authorization", "Bearer "+c.Token)
+		h.Set("Authorization", "Bearer "+c.Token)
+	}
+	h.Set("Music-Let-Version", "v0.0.2")
+	if c.ID != "" {
+		h.Set("Music-Let-ID", c.ID)
 	}
-	req.Header.Set("Music-Let-Version", "v0.0.2")
 }
 
 // GetTask 通过长轮询获取任务
 func (c *Client) GetTask(ctx context.Context) (*Task, error) {
 	url := fmt.Sprintf("%s/tasks/poll?timeout=%d", c.ServerURL, int(c.PollTimeout.Seconds()))
+	if len(c.Types) > 0 {
+		url += "&types=" + neturl.QueryEscape(strings.Join(c.Types, ","))
+	}
+	if c.Lease {
+		url += "&heartbeat=1"
+	}
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -110,3 +131,71 @@ func (c *Client) SubmitResult(result *Result) error {
 
 	return nil
 }
+
+// Heartbeat 续约正在执行的任务，返回服务器要求取消的任务 ID
+func (c *Client) Heartbeat(ctx context.Context, beats []Heartbeat) ([]string, error) {
+	body, err := json.Marshal(map[string][]Heartbeat{"tasks": beats})
+	if err != nil {
+		return nil, fmt.Errorf("序列化心跳失败: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/tasks/heartbeat", c.ServerURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	c.setHeader(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送心跳失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("服务器返回错误状态: %d", resp.StatusCode)
+	}
+
+	var res struct {
+		Cancelled []string `json:"cancelled"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+	return res.Cancelled, nil
+}
+
+// Progress 报告任务进度，返回任务是否需要取消
+func (c *Client) Progress(ctx context.Context, p *Progress) (bool, error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return false, fmt.Errorf("序列化进度失败: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/tasks/progress", c.ServerURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return false, fmt.Errorf("创建请求失败: %w", err)
+	}
+	c.setHeader(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("报告进度失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("服务器返回错误状态: %d", resp.StatusCode)
+	}
+
+	var res struct {
+		Cancelled []string `json:"cancelled"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return false, fmt.Errorf("解析响应失败: %w", err)
+	}
+	return len(res.Cancelled) > 0, nil
+}
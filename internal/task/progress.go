@@ -0,0 +1,17 @@
+package task
+
+import "context"
+
+type progressKey struct{}
+
+// WithProgress 返回携带进度回调的 ctx，CallContext 会将任务的进度交给 fn
+//
+// fn 在报告进度的 worker 请求中同步调用，不应阻塞。
+func WithProgress(ctx context.Context, fn func(Progress)) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+func progressFunc(ctx context.Context) func(Progress) {
+	fn, _ := ctx.Value(progressKey{}).(func(Progress))
+	return fn
+}
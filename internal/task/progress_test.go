@@ -0,0 +1,37 @@
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	s := NewServer("")
+	defer s.Close()
+
+	stages := make(chan string, 4)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ctx = WithProgress(ctx, func(p Progress) { stages <- p.Stage })
+
+	go func() {
+		task := s.tasks.poll(context.Background(), poller{version: testVersion})
+		if c := s.reportProgress(Progress{ID: task.ID, Attempt: task.Attempt + 1, Stage: StageUploading}); len(c) != 1 {
+			t.Errorf("progress for stale attempt not cancelled: %v", c)
+		}
+		s.reportProgress(Progress{ID: task.ID, Attempt: task.Attempt, Stage: StageDownloading, Percent: 50})
+		_ = s.submit("", &Result{ID: task.ID, Success: true})
+	}()
+	if r := s.CallContext(ctx, &Task{ID: "1", Type: "a"}); r == nil || !r.Success {
+		t.Fatalf("CallContext() = %+v, want success", r)
+	}
+	close(stages)
+	var got []string
+	for stage := range stages {
+		got = append(got, stage)
+	}
+	if len(got) != 2 || got[0] != StageQueued || got[1] != StageDownloading {
+		t.Errorf("stages = %v, want [queued downloading]", got)
+	}
+}
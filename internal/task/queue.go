@@ -0,0 +1,315 @@
+package task
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/semver"
+)
+
+// workerTTL worker 轮询结束后仍视为在线的时间，略长于默认的轮询超时
+const workerTTL = 45 * time.Second
+
+// anyType 未声明任务类型的 worker，可以领取任意类型的任务
+const anyType = "*"
+
+// queue 按任务类型分发任务的队列
+//
+// 任务按提交顺序排队，worker 轮询时只会领取自己声明支持、且版本满足要求的类型，
+// 没有匹配的任务时登记为 waiter，等待新任务直接交给它。
+type queue struct {
+	mu      sync.Mutex
+	pending []*queued
+	waiters []*waiter
+
+	minVersions map[string]semver.Version // 任务类型 -> 要求的最低 worker 版本
+	declared    map[string]bool           // 只交给明确声明支持的 worker 的任务类型
+	policies    map[string]RetryPolicy    // 任务类型 -> 重试策略，"" 为默认策略
+	seen        map[string]lastPoll       // 任务类型 -> 支持该类型的 worker 最后一次轮询
+	running     map[string]int            // 任务类型 -> 已分发但未返回结果的任务数
+	leases      map[string]*lease         // 已分发的任务 ID -> 租约
+	workers     map[string]*worker        // worker ID -> 状态
+}
+
+// queued 排队中的任务
+type queued struct {
+	task *Task
+	time time.Time
+}
+
+// poller 一次轮询的 worker 信息
+type poller struct {
+	id        string   // worker ID
+	remote    string   // worker 的地址
+	types     []string // 为空表示接受任意类型
+	version   semver.Version
+	heartbeat bool // worker 会发送心跳，分发的任务有租约
+}
+
+type waiter struct {
+	poller
+	ch chan *Task
+}
+
+// lease 已分发任务的租约
+type lease struct {
+	task       *Task
+	worker     string // 领取任务的 worker ID
+	dispatched time.Time
+	expires    time.Time // 零值表示 worker 不发送心跳，租约不会过期
+}
+
+// lastPoll worker 最后一次轮询的时间和版本
+type lastPoll struct {
+	time    time.Time
+	version semver.Version
+}
+
+func newQueue() *queue {
+	return &queue{
+		minVersions: make(map[string]semver.Version),
+		declared:    make(map[string]bool),
+		policies:    map[string]RetryPolicy{"": DefaultRetryPolicy},
+		seen:        make(map[string]lastPoll),
+		running:     make(map[string]int),
+		leases:      make(map[string]*lease),
+		workers:     make(map[string]*worker),
+	}
+}
+
+// supports 版本为 version 的 worker 能否执行该类型的任务，调用方需持有 q.mu
+func (q *queue) supports(version semver.Version, taskType string) bool {
+	v, ok := q.minVersions[taskType]
+	return !ok || version.GreaterEqual(v)
+}
+
+// accept worker 是否可以领取该类型的任务，调用方需持有 q.mu
+func (q *queue) accept(w *waiter, taskType string) bool {
+	if len(w.types) == 0 {
+		return !q.declared[taskType] && q.supports(w.version, taskType)
+	}
+	return slices.Contains(w.types, taskType) && q.supports(w.version, taskType)
+}
+
+// requireVersion 设置任务类型要求的最低 worker 版本
+func (q *queue) requireVersion(taskType string, version semver.Version) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.minVersions[taskType] = version
+}
+
+// requireDeclared 设置任务类型只交给声明支持该类型的 worker
+func (q *queue) requireDeclared(taskType string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.declared[taskType] = true
+}
+
+// setPolicies 替换所有任务类型的重试策略，必须包含默认策略 ""
+func (q *queue) setPolicies(policies map[string]RetryPolicy) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.policies = policies
+}
+
+// policy 返回任务类型的重试策略
+func (q *queue) policy(taskType string) RetryPolicy {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.policyLocked(taskType)
+}
+
+// policyLocked 返回任务类型的重试策略，调用方需持有 q.mu
+func (q *queue) policyLocked(taskType string) RetryPolicy {
+	if p, ok := q.policies[taskType]; ok {
+		return p
+	}
+	return q.policies[""]
+}
+
+// push 添加任务，有等待中的 worker 支持该类型时直接交给它
+func (q *queue) push(t *Task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, w := range q.waiters {
+		if q.accept(w, t.Type) {
+			q.waiters = slices.Delete(q.waiters, i, i+1)
+			q.dispatch(t, w)
+			w.ch <- t
+			return
+		}
+	}
+	q.pending = append(q.pending, &queued{task: t, time: time.Now()})
+}
+
+// remove 移除尚未分发的任务，返回任务是否仍在排队
+func (q *queue) remove(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, p := range q.pending {
+		if p.task.ID == id {
+			q.pending = slices.Delete(q.pending, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// done 任务结束，不再计入正在执行的任务
+func (q *queue) done(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.release(id)
+}
+
+// release 释放任务的租约，调用方需持有 q.mu
+func (q *queue) release(id string) {
+	if l, ok := q.leases[id]; ok {
+		delete(q.leases, id)
+		q.running[l.task.Type]--
+	}
+}
+
+// dispatch 记录任务已分发给 worker，调用方需持有 q.mu
+func (q *queue) dispatch(t *Task, w *waiter) {
+	l := &lease{task: t, worker: w.id, dispatched: time.Now()}
+	if w.heartbeat {
+		l.expires = time.Now().Add(q.policyLocked(t.Type).Lease)
+	}
+	q.leases[t.ID] = l
+	q.running[t.Type]++
+}
+
+// heartbeat 续约 worker 正在执行的任务，返回需要取消的任务：
+// 调用方已放弃、已经完成或已重新分发给其他 worker 的任务
+func (q *queue) heartbeat(beats []Heartbeat) []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cancelled := make([]string, 0)
+	for _, b := range beats {
+		l, ok := q.leases[b.ID]
+		if !ok || l.task.Attempt != b.Attempt {
+			cancelled = append(cancelled, b.ID)
+			continue
+		}
+		if !l.expires.IsZero() {
+			l.expires = time.Now().Add(q.policyLocked(l.task.Type).Lease)
+		}
+	}
+	return cancelled
+}
+
+// abandon 让 worker 放弃的任务的租约立即过期，任务按重试策略重新排队
+func (q *queue) abandon(beats []Heartbeat) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, b := range beats {
+		if l, ok := q.leases[b.ID]; ok && l.task.Attempt == b.Attempt {
+			l.expires = time.Now()
+		}
+	}
+}
+
+// expired 移除并返回租约已过期的任务
+func (q *queue) expired() []*Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	var tasks []*Task
+	for id, l := range q.leases {
+		if !l.expires.IsZero() && now.After(l.expires) {
+			q.release(id)
+			if w, ok := q.workers[l.worker]; ok {
+				w.lost++
+			}
+			tasks = append(tasks, l.task)
+		}
+	}
+	return tasks
+}
+
+// poll 领取一个 worker 支持的任务，ctx 结束时返回 nil
+//
+// p.heartbeat 为 true 时 worker 需要定期发送心跳，否则任务只在调用方结束时释放。
+func (q *queue) poll(ctx context.Context, p poller) *Task {
+	w := &waiter{poller: p, ch: make(chan *Task, 1)}
+
+	q.mu.Lock()
+	q.touch(w)
+	for i, p := range q.pending {
+		if q.accept(w, p.task.Type) {
+			q.pending = slices.Delete(q.pending, i, i+1)
+			q.dispatch(p.task, w)
+			q.mu.Unlock()
+			return p.task
+		}
+	}
+	q.waiters = append(q.waiters, w)
+	q.worker(w).polling++
+	q.mu.Unlock()
+
+	var t *Task
+	select {
+	case t = <-w.ch:
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.worker(w).polling--
+	q.touch(w)
+	if t != nil {
+		return t
+	}
+	if i := slices.Index(q.waiters, w); i >= 0 {
+		q.waiters = slices.Delete(q.waiters, i, i+1)
+		return nil
+	}
+	// 超时的同时收到了任务
+	return <-w.ch
+}
+
+// touch 记录 worker 的轮询时间，调用方需持有 q.mu
+func (q *queue) touch(w *waiter) {
+	s := lastPoll{time: time.Now(), version: w.version}
+	if len(w.types) == 0 {
+		q.seen[anyType] = s
+	}
+	for _, t := range w.types {
+		q.seen[t] = s
+	}
+	q.worker(w).poll(w.poller)
+}
+
+// available 是否有支持该类型的 worker 在线：正在轮询、最近轮询过或正在执行该类型的任务
+func (q *queue) available(taskType string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, w := range q.waiters {
+		if q.accept(w, taskType) {
+			return true
+		}
+	}
+	if q.running[taskType] > 0 {
+		return true
+	}
+	for _, t := range []string{taskType, anyType} {
+		if t == anyType && q.declared[taskType] {
+			continue
+		}
+		s, ok := q.seen[t]
+		if ok && time.Since(s.time) < workerTTL && q.supports(s.version, taskType) {
+			return true
+		}
+	}
+	return false
+}
+
+// len 排队中的任务数
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
@@ -0,0 +1,148 @@
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/semver"
+)
+
+var testVersion = semver.Parse("v0.1.0")
+
+func TestQueueRouteByType(t *testing.T) {
+	q := newQueue()
+	q.push(&Task{ID: "1", Type: "bilibili:get_music"})
+	q.push(&Task{ID: "2", Type: "url_common:get_music"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if task := q.poll(ctx, poller{types: []string{"url_common:get_music"}, version: testVersion}); task == nil || task.ID != "2" {
+		t.Fatalf("poll(url_common) = %+v, want task 2", task)
+	}
+	if task := q.poll(ctx, poller{types: []string{"bilibili:search_music"}, version: testVersion}); task != nil {
+		t.Fatalf("poll(search) = %+v, want nil", task)
+	}
+	if task := q.poll(context.Background(), poller{version: testVersion}); task == nil || task.ID != "1" {
+		t.Fatalf("poll(any) = %+v, want task 1", task)
+	}
+}
+
+func TestQueueWaiter(t *testing.T) {
+	q := newQueue()
+	got := make(chan *Task)
+	go func() {
+		got <- q.poll(context.Background(), poller{types: []string{"a"}, version: testVersion})
+	}()
+	for !q.available("a") {
+		time.Sleep(time.Millisecond)
+	}
+	if q.available("b") {
+		t.Error("available(b) = true, want false")
+	}
+
+	q.push(&Task{ID: "1", Type: "b"})
+	q.push(&Task{ID: "2", Type: "a"})
+	if task := <-got; task.ID != "2" {
+		t.Errorf("waiter got task %s, want 2", task.ID)
+	}
+	if q.len() != 1 {
+		t.Errorf("len() = %d, want 1", q.len())
+	}
+	// 任务执行中时仍视为有 worker 在线
+	if !q.available("a") {
+		t.Error("available(a) = false while task is running")
+	}
+	q.done("2")
+}
+
+func TestQueueMinVersion(t *testing.T) {
+	q := newQueue()
+	q.requireVersion("a", semver.Parse("v0.2.0"))
+	q.push(&Task{ID: "1", Type: "a"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if task := q.poll(ctx, poller{types: []string{"a"}, version: testVersion}); task != nil {
+		t.Fatalf("old worker got task %+v", task)
+	}
+	if task := q.poll(context.Background(), poller{types: []string{"a"}, version: semver.Parse("v0.2.0")}); task == nil {
+		t.Fatal("new worker got no task")
+	}
+}
+
+func TestQueueLease(t *testing.T) {
+	q := newQueue()
+	q.setPolicies(map[string]RetryPolicy{
+		"":  DefaultRetryPolicy,
+		"a": {Attempts: 2, Lease: 20 * time.Millisecond},
+	})
+	q.push(&Task{ID: "1", Type: "a", Attempt: 1})
+	q.push(&Task{ID: "2", Type: "a", Attempt: 1})
+
+	alive := q.poll(context.Background(), poller{types: []string{"a"}, version: testVersion, heartbeat: true})
+	lost := q.poll(context.Background(), poller{types: []string{"a"}, version: testVersion, heartbeat: true})
+
+	for range 3 {
+		time.Sleep(10 * time.Millisecond)
+		if cancelled := q.heartbeat([]Heartbeat{{ID: alive.ID, Attempt: 1}}); len(cancelled) != 0 {
+			t.Fatalf("heartbeat cancelled %v", cancelled)
+		}
+	}
+	expired := q.expired()
+	if len(expired) != 1 || expired[0].ID != lost.ID {
+		t.Fatalf("expired() = %v, want task %s", expired, lost.ID)
+	}
+	// 已过期和旧的分发都会被取消
+	cancelled := q.heartbeat([]Heartbeat{{ID: lost.ID, Attempt: 1}, {ID: alive.ID, Attempt: 2}})
+	if len(cancelled) != 2 {
+		t.Errorf("heartbeat() cancelled = %v, want both", cancelled)
+	}
+}
+
+func TestQueueWorkers(t *testing.T) {
+	q := newQueue()
+	q.push(&Task{ID: "1", Type: "a", Attempt: 1})
+	q.push(&Task{ID: "2", Type: "b", Attempt: 1})
+	if task := q.poll(context.Background(), poller{id: "w1", types: []string{"a"}, version: testVersion, heartbeat: true}); task == nil {
+		t.Fatal("poll(w1) = nil")
+	}
+	q.report("w1", true)
+	q.report("w1", false)
+	q.report("unknown", true)
+
+	workers := q.workerStatus()
+	if len(workers) != 1 {
+		t.Fatalf("workerStatus() = %+v, want 1 worker", workers)
+	}
+	w := workers[0]
+	if w.ID != "w1" || !w.Online || w.Version != testVersion.String() || w.Succeeded != 1 || w.Failed != 1 {
+		t.Errorf("worker = %+v", w)
+	}
+	if len(w.Running) != 1 || w.Running[0].ID != "1" || w.Running[0].Expires == 0 {
+		t.Errorf("worker running = %+v, want task 1 with lease", w.Running)
+	}
+
+	s := q.status()
+	if len(s.Pending) != 1 || s.Pending[0].ID != "2" || len(s.Running) != 1 || s.Running[0].Worker != "w1" {
+		t.Errorf("status() = %+v", s)
+	}
+}
+
+func TestQueueDeclared(t *testing.T) {
+	q := newQueue()
+	q.requireDeclared("local:get_music")
+	q.push(&Task{ID: "1", Type: "local:get_music"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if task := q.poll(ctx, poller{version: testVersion}); task != nil {
+		t.Fatalf("untyped worker got task %+v", task)
+	}
+	if q.available("local:get_music") {
+		t.Error("available() = true with only an untyped worker")
+	}
+	if task := q.poll(context.Background(), poller{types: []string{"local:get_music"}, version: testVersion}); task == nil {
+		t.Fatal("declaring worker got no task")
+	}
+}
@@ -0,0 +1,47 @@
+package task
+
+import "time"
+
+// RetryPolicy 任务类型的重试策略
+type RetryPolicy struct {
+	// Attempts 最多分发的次数，包括第一次
+	Attempts int
+	// Lease 任务租约的时长，worker 需要在租约到期前发送心跳，
+	// 否则视为 worker 已失联，任务重新排队交给其他 worker
+	Lease time.Duration
+	// Backoff 重试前等待的时间
+	Backoff time.Duration
+	// RetryOnFailure 为 true 时 worker 返回失败结果也会重试，否则只在租约过期时重试
+	RetryOnFailure bool
+}
+
+// DefaultRetryPolicy 未单独配置的任务类型使用的重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts: 2,
+	Lease:    30 * time.Second,
+	Backoff:  time.Second,
+}
+
+// normalize 未设置的字段使用 DefaultRetryPolicy 的值
+func (p RetryPolicy) normalize() RetryPolicy {
+	if p.Attempts < 1 {
+		p.Attempts = DefaultRetryPolicy.Attempts
+	}
+	if p.Lease <= 0 {
+		p.Lease = DefaultRetryPolicy.Lease
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = DefaultRetryPolicy.Backoff
+	}
+	return p
+}
+
+// SetRetryPolicies 替换所有任务类型的重试策略，键为任务类型，"" 为默认策略，
+// 未指定默认策略时使用 DefaultRetryPolicy
+func (s *Server) SetRetryPolicies(policies map[string]RetryPolicy) {
+	m := map[string]RetryPolicy{"": DefaultRetryPolicy}
+	for t, p := range policies {
+		m[t] = p.normalize()
+	}
+	s.tasks.setPolicies(m)
+}
@@ -3,44 +3,99 @@ package task
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/metrics"
 	"github.com/bihua-university/alisten/internal/semver"
-	"github.com/bihua-university/alisten/internal/syncx"
 )
 
 var Scheduler *Server // manual initialize
 
 // Server 长轮询任务服务器
 type Server struct {
-	token   string
-	tasks   syncx.UnboundedChan[*Task]
-	results sync.Map      // map[string]chan *Result
-	idGen   atomic.Uint64 // 原子计数器，用于生成唯一ID
+	token    atomic.Pointer[string]
+	tasks    *queue
+	results  sync.Map      // map[string]chan *Result
+	progress sync.Map      // map[string]func(Progress)
+	idGen    atomic.Uint64 // 原子计数器，用于生成唯一ID
+
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
+// closedMessage 服务器关闭时任务失败的原因
+const closedMessage = "服务器正在关闭"
+
+// leaseCheckInterval 检查租约是否过期的间隔
+const leaseCheckInterval = time.Second
+
 var minAllowedVersion = semver.Parse("v0.0.2")
 
+// ErrNoWorker 没有支持该任务类型的 worker 在线
+var ErrNoWorker = errors.New("no musiclet worker available")
+
 // NewServer 创建新的任务服务器
 func NewServer(token string) *Server {
-	return &Server{
-		tasks: syncx.NewUnboundedChan[*Task](32),
-		token: token,
+	s := &Server{
+		tasks:  newQueue(),
+		closed: make(chan struct{}),
+	}
+	s.SetToken(token)
+	go s.reap()
+	return s
+}
+
+// reap 定期检查租约，租约过期的任务通知调用方重新排队
+func (s *Server) reap() {
+	ticker := time.NewTicker(leaseCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+		}
+		s.tasks.forget()
+		for _, t := range s.tasks.expired() {
+			slog.Warn("task lease expired", base.LogTask, t.ID, "type", t.Type, "attempt", t.Attempt)
+			if ch, ok := s.results.Load(t.ID); ok {
+				select {
+				case ch.(chan *Result) <- &Result{ID: t.ID, Error: "worker 失联", lost: true}:
+				default:
+				}
+			}
+		}
 	}
 }
 
+// SetToken 修改 musiclet 使用的认证令牌，为空时不验证
+func (s *Server) SetToken(token string) {
+	s.token.Store(&token)
+}
+
 // NewTask 创建一个新的任务，自动生成ID
-func (s *Server) NewTask(taskType string, data map[string]string) *Task {
+//
+// 没有支持该任务类型的 worker 在线时返回 ErrNoWorker，避免调用方等待到超时。
+func (s *Server) NewTask(taskType string, data map[string]string) (*Task, error) {
+	if !s.tasks.available(taskType) {
+		return nil, fmt.Errorf("%w for task type %s", ErrNoWorker, taskType)
+	}
 	id := s.idGen.Add(1)
 	return &Task{
 		ID:   strconv.FormatUint(id, 10),
 		Type: taskType,
 		Data: data,
-	}
+	}, nil
 }
 
 // Call 同步调用任务，添加任务并等待结果
@@ -50,17 +105,94 @@ func (s *Server) Call(task *Task, timeout time.Duration) *Result {
 	return s.CallContext(ctx, task)
 }
 
+// RequireVersion 设置任务类型要求的最低 worker 版本，版本过低的 worker 不会领取该类型的任务
+func (s *Server) RequireVersion(taskType, version string) {
+	s.tasks.requireVersion(taskType, semver.Parse(version))
+}
+
+// RequireDeclared 设置任务类型只交给在 types 中声明支持该类型的 worker，
+// 未声明任务类型的旧版 worker 不会领取该类型的任务
+func (s *Server) RequireDeclared(taskType string) {
+	s.tasks.requireDeclared(taskType)
+}
+
+// Close 关闭服务器，正在等待结果的调用立即失败，之后的调用和轮询直接返回
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+}
+
+// CallContext 添加任务并等待结果，ctx 结束时返回 nil，服务器关闭时返回失败的结果
+//
+// worker 失联（租约过期）或返回失败结果时，按任务类型的重试策略重新排队。
+// 调用结束时仍在执行的任务会在 worker 下一次心跳时取消。
 func (s *Server) CallContext(ctx context.Context, task *Task) *Result {
+	select {
+	case <-s.closed:
+		return NewResultWithError(task.ID, closedMessage)
+	default:
+	}
+
 	resultChan := make(chan *Result, 1)
 	s.results.Store(task.ID, resultChan)
 	defer s.results.Delete(task.ID)
+	onProgress := progressFunc(ctx)
+	if onProgress != nil {
+		s.progress.Store(task.ID, onProgress)
+		defer s.progress.Delete(task.ID)
+	}
+	defer s.tasks.done(task.ID)
+	defer s.tasks.remove(task.ID) // 调用结束时任务仍未分发则不再分发
 
-	s.tasks.In() <- task
-	select {
-	case result := <-resultChan:
-		return result
-	case <-ctx.Done():
-		return nil
+	metrics.TaskInFlight.Inc()
+	defer metrics.TaskInFlight.Dec()
+	start := time.Now()
+
+	log := slog.With(base.LogTask, task.ID, "type", task.Type)
+	policy := s.tasks.policy(task.Type)
+	for attempt := 1; ; attempt++ {
+		// 每次分发使用新的副本，避免与正在编码的旧任务竞争
+		t := *task
+		t.Attempt = attempt
+		s.tasks.push(&t)
+		metrics.TaskPending.Set(float64(s.tasks.len()))
+		log.Debug("task queued", "attempt", attempt)
+		if onProgress != nil {
+			onProgress(Progress{ID: task.ID, Attempt: attempt, Stage: StageQueued})
+		}
+
+		var result *Result
+		select {
+		case result = <-resultChan:
+		case <-ctx.Done():
+			metrics.TaskTimeouts.WithLabelValues(task.Type).Inc()
+			log.Warn("task timeout", "error", ctx.Err())
+			return nil
+		case <-s.closed:
+			log.Info("task failed, server closed")
+			return NewResultWithError(task.ID, closedMessage)
+		}
+
+		retry := result.lost || (!result.Success && policy.RetryOnFailure)
+		if !retry || attempt >= policy.Attempts {
+			metrics.TaskDuration.WithLabelValues(task.Type).Observe(time.Since(start).Seconds())
+			log.Debug("task done", "duration", time.Since(start), "attempt", attempt, "success", result.Success)
+			return result
+		}
+
+		// 释放本次的租约，之前的 worker 会在下一次心跳时收到取消
+		s.tasks.done(task.ID)
+		metrics.TaskRetries.WithLabelValues(task.Type).Inc()
+		log.Info("task retry", "attempt", attempt, "error", result.Error)
+		select {
+		case <-time.After(policy.Backoff):
+		case <-ctx.Done():
+			metrics.TaskTimeouts.WithLabelValues(task.Type).Inc()
+			return nil
+		case <-s.closed:
+			return NewResultWithError(task.ID, closedMessage)
+		}
 	}
 }
 
@@ -86,7 +218,8 @@ func (s *Server) precheck(r *http.Request, w http.ResponseWriter) bool {
 }
 
 func (s *Server) validateToken(r *http.Request) bool {
-	if s.token == "" {
+	expected := *s.token.Load()
+	if expected == "" {
 		return true // 如果没有设置token，则不验证
 	}
 
@@ -101,7 +234,7 @@ func (s *Server) validateToken(r *http.Request) bool {
 	}
 
 	token := authHeader[len(bearerPrefix):]
-	return token == s.token
+	return token == expected
 }
 
 // PollTaskHandler 长轮询获取任务的处理器
@@ -119,14 +252,35 @@ func (s *Server) PollTaskHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 创建带超时的上下文
+	// worker 支持的任务类型，未声明时可以领取任意类型的任务
+	types := parseTypes(r.URL.Query().Get("types"))
+
+	// 创建带超时的上下文，服务器关闭时立即返回
 	ctx, cancel := context.WithTimeout(r.Context(), timeout)
 	defer cancel()
+	go func() {
+		select {
+		case <-s.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	select {
-	case task := <-s.tasks.Out():
+	task := s.tasks.poll(ctx, poller{
+		id:        workerID(r),
+		remote:    r.RemoteAddr,
+		types:     types,
+		version:   semver.Parse(r.Header.Get("Music-Let-Version")),
+		heartbeat: r.URL.Query().Get("heartbeat") != "",
+	})
+	switch {
+	case task != nil:
+		metrics.TaskPending.Set(float64(s.tasks.len()))
+		slog.Debug("task dispatched", base.LogTask, task.ID, "type", task.Type, "worker", workerID(r))
 		writeJSON(w, http.StatusOK, task)
-	case <-ctx.Done():
+	case s.isClosed():
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": closedMessage})
+	default:
 		// 超时，返回空内容
 		writeJSON(w, http.StatusNoContent, nil)
 	}
@@ -144,15 +298,134 @@ func (s *Server) SubmitResultHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 通过任务ID查找对应的结果通道
-	if chanInterface, ok := s.results.Load(result.ID); ok {
-		if resultChan, ok := chanInterface.(chan *Result); ok {
-			resultChan <- &result
-			writeJSON(w, http.StatusOK, map[string]string{"message": "结果已接收"})
-			return
+	switch err := s.submit(workerID(r), &result); {
+	case errors.Is(err, errDuplicateResult):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "任务已有结果"})
+	case err != nil:
+		slog.Warn("result for unknown task", base.LogTask, result.ID, "worker", workerID(r))
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "未找到对应的任务"})
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"message": "结果已接收"})
+	}
+}
+
+var (
+	errUnknownTask     = errors.New("unknown task")
+	errDuplicateResult = errors.New("task already has a result")
+)
+
+// submit 将 worker 提交的结果交给等待的调用方
+func (s *Server) submit(worker string, result *Result) error {
+	ch, ok := s.results.Load(result.ID)
+	if !ok {
+		return errUnknownTask
+	}
+	select {
+	case ch.(chan *Result) <- result:
+		s.tasks.report(worker, result.Success)
+		return nil
+	default:
+		// 任务重新分发后，其他 worker 已经提交了结果
+		return errDuplicateResult
+	}
+}
+
+// HeartbeatHandler 续约 worker 正在执行的任务，返回需要取消的任务 ID
+//
+// 请求体为 {"tasks": [{"id": "1", "attempt": 1}]}，返回 {"cancelled": ["1"]}。
+func (s *Server) HeartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.precheck(r, w) {
+		return
+	}
+
+	var req struct {
+		Tasks []Heartbeat `json:"tasks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "无效的JSON格式"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"cancelled": s.tasks.heartbeat(req.Tasks)})
+}
+
+// Workers 返回所有 worker 的状态
+func (s *Server) Workers() []WorkerStatus {
+	return s.tasks.workerStatus()
+}
+
+// Queue 返回任务队列的状态
+func (s *Server) Queue() QueueStatus {
+	return s.tasks.status()
+}
+
+// WorkersHandler 返回所有 worker 的状态，调用方负责鉴权
+func (s *Server) WorkersHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Workers())
+}
+
+// QueueHandler 返回任务队列的状态，调用方负责鉴权
+func (s *Server) QueueHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Queue())
+}
+
+// workerID 返回请求的 worker ID，未携带 Music-Let-ID 时使用客户端 IP
+func workerID(r *http.Request) string {
+	if id := r.Header.Get("Music-Let-ID"); id != "" {
+		return id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ProgressHandler worker 报告任务进度，同时视为该任务的心跳
+//
+// 请求体为 Progress，返回 {"cancelled": ["1"]}，任务需要取消时包含该任务的 ID。
+func (s *Server) ProgressHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.precheck(r, w) {
+		return
+	}
+
+	var p Progress
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "无效的JSON格式"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"cancelled": s.reportProgress(p)})
+}
+
+// reportProgress 续约任务并将进度交给调用方，返回需要取消的任务
+func (s *Server) reportProgress(p Progress) []string {
+	cancelled := s.tasks.heartbeat([]Heartbeat{{ID: p.ID, Attempt: p.Attempt}})
+	if len(cancelled) > 0 {
+		return cancelled
+	}
+	if fn, ok := s.progress.Load(p.ID); ok {
+		fn.(func(Progress))(p)
+	}
+	return cancelled
+}
+
+// parseTypes 解析逗号分隔的任务类型
+func parseTypes(s string) []string {
+	var types []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
 		}
 	}
-	writeJSON(w, http.StatusNotFound, map[string]string{"error": "未找到对应的任务"})
+	return types
+}
+
+func (s *Server) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
 }
 
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
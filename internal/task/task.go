@@ -4,9 +4,32 @@ import "encoding/json"
 
 // Task 表示一个任务
 type Task struct {
-	ID   string            `json:"id"`
-	Type string            `json:"type"`
-	Data map[string]string `json:"payload"`
+	ID      string            `json:"id"`
+	Type    string            `json:"type"`
+	Data    map[string]string `json:"payload"`
+	Attempt int               `json:"attempt,omitempty"` // 第几次分发，从 1 开始
+}
+
+// Heartbeat worker 对正在执行的任务发送的心跳
+type Heartbeat struct {
+	ID      string `json:"id"`
+	Attempt int    `json:"attempt"`
+}
+
+// 任务进度的阶段
+const (
+	StageQueued      = "queued"      // 等待 worker 领取，由服务器报告
+	StageDownloading = "downloading" // 正在下载，percent 为下载进度
+	StageUploading   = "uploading"   // 正在上传
+	StageDone        = "done"        // 已完成，即将提交结果
+)
+
+// Progress worker 报告的任务进度
+type Progress struct {
+	ID      string  `json:"id"`
+	Attempt int     `json:"attempt"`
+	Stage   string  `json:"stage"`
+	Percent float64 `json:"percent,omitempty"` // 0 到 100
 }
 
 // Result 表示任务执行结果
@@ -15,6 +38,8 @@ type Result struct {
 	Success bool            `json:"success"`
 	Result  json.RawMessage `json:"result,omitempty"`
 	Error   string          `json:"error,omitempty"`
+
+	lost bool // 租约过期，worker 已失联
 }
 
 // NewResult 创建一个新的任务结果
@@ -0,0 +1,198 @@
+package task
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/semver"
+)
+
+// workerForget 离线超过该时间且没有正在执行的任务的 worker 从列表中移除
+const workerForget = 10 * time.Minute
+
+// worker 轮询过任务的 musiclet worker
+type worker struct {
+	id       string
+	remote   string
+	version  semver.Version
+	types    []string
+	lastPoll time.Time
+	polling  int // 正在等待任务的轮询数
+
+	succeeded int
+	failed    int
+	lost      int
+}
+
+// poll 记录 worker 的一次轮询
+func (w *worker) poll(p poller) {
+	w.remote = p.remote
+	w.version = p.version
+	w.types = p.types
+	w.lastPoll = time.Now()
+}
+
+// WorkerStatus worker 的状态，时间为毫秒时间戳
+type WorkerStatus struct {
+	ID        string        `json:"id"`
+	Remote    string        `json:"remote"`
+	Version   string        `json:"version"`
+	Types     []string      `json:"types"` // 为空表示接受任意类型
+	Online    bool          `json:"online"`
+	Polling   bool          `json:"polling"` // 正在等待任务
+	LastPoll  int64         `json:"lastPoll"`
+	Running   []RunningTask `json:"running"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Lost      int           `json:"lost"` // 租约过期的次数
+}
+
+// PendingTask 排队中的任务，时间为毫秒时间戳
+type PendingTask struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Attempt int    `json:"attempt"`
+	Queued  int64  `json:"queued"`
+}
+
+// RunningTask 已分发的任务，时间为毫秒时间戳
+type RunningTask struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Attempt    int    `json:"attempt"`
+	Worker     string `json:"worker"`
+	Dispatched int64  `json:"dispatched"`
+	Expires    int64  `json:"expires,omitempty"` // 租约到期时间，worker 不发送心跳时为空
+}
+
+// QueueStatus 任务队列的状态
+type QueueStatus struct {
+	Pending []PendingTask `json:"pending"`
+	Running []RunningTask `json:"running"`
+	Waiting int           `json:"waiting"` // 正在等待任务的轮询数
+}
+
+// worker 返回 waiter 对应的 worker，不存在时创建，调用方需持有 q.mu
+func (q *queue) worker(w *waiter) *worker {
+	wk, ok := q.workers[w.id]
+	if !ok {
+		wk = &worker{id: w.id}
+		q.workers[w.id] = wk
+	}
+	return wk
+}
+
+// keepalive 记录保持连接的 worker 仍然在线
+func (q *queue) keepalive(p poller) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.touch(&waiter{poller: p})
+}
+
+// report 记录 worker 提交的结果
+func (q *queue) report(id string, success bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	w, ok := q.workers[id]
+	if !ok {
+		return
+	}
+	if success {
+		w.succeeded++
+	} else {
+		w.failed++
+	}
+}
+
+// runningTasks 返回已分发的任务，按分发时间排序，调用方需持有 q.mu
+func (q *queue) runningTasks() []RunningTask {
+	tasks := make([]RunningTask, 0, len(q.leases))
+	for _, l := range q.leases {
+		t := RunningTask{
+			ID:         l.task.ID,
+			Type:       l.task.Type,
+			Attempt:    l.task.Attempt,
+			Worker:     l.worker,
+			Dispatched: l.dispatched.UnixMilli(),
+		}
+		if !l.expires.IsZero() {
+			t.Expires = l.expires.UnixMilli()
+		}
+		tasks = append(tasks, t)
+	}
+	slices.SortFunc(tasks, func(a, b RunningTask) int { return cmp.Compare(a.Dispatched, b.Dispatched) })
+	return tasks
+}
+
+// forget 移除离线已久且没有正在执行的任务的 worker
+func (q *queue) forget() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for id, w := range q.workers {
+		if w.polling == 0 && time.Since(w.lastPoll) > workerForget && !q.hasLease(id) {
+			delete(q.workers, id)
+		}
+	}
+}
+
+// hasLease worker 是否有正在执行的任务，调用方需持有 q.mu
+func (q *queue) hasLease(worker string) bool {
+	for _, l := range q.leases {
+		if l.worker == worker {
+			return true
+		}
+	}
+	return false
+}
+
+// workerStatus 返回所有 worker 的状态
+func (q *queue) workerStatus() []WorkerStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	running := q.runningTasks()
+	list := make([]WorkerStatus, 0, len(q.workers))
+	for id, w := range q.workers {
+		s := WorkerStatus{
+			ID:        w.id,
+			Remote:    w.remote,
+			Version:   w.version.String(),
+			Types:     w.types,
+			Online:    w.polling > 0 || time.Since(w.lastPoll) < workerTTL,
+			Polling:   w.polling > 0,
+			LastPoll:  w.lastPoll.UnixMilli(),
+			Running:   make([]RunningTask, 0),
+			Succeeded: w.succeeded,
+			Failed:    w.failed,
+			Lost:      w.lost,
+		}
+		for _, t := range running {
+			if t.Worker == id {
+				s.Running = append(s.Running, t)
+			}
+		}
+		list = append(list, s)
+	}
+	slices.SortFunc(list, func(a, b WorkerStatus) int { return cmp.Compare(a.ID, b.ID) })
+	return list
+}
+
+// status 返回任务队列的状态
+func (q *queue) status() QueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := QueueStatus{
+		Pending: make([]PendingTask, 0, len(q.pending)),
+		Running: q.runningTasks(),
+		Waiting: len(q.waiters),
+	}
+	for _, p := range q.pending {
+		s.Pending = append(s.Pending, PendingTask{
+			ID:      p.task.ID,
+			Type:    p.task.Type,
+			Attempt: p.task.Attempt,
+			Queued:  p.time.UnixMilli(),
+		})
+	}
+	return s
+}
@@ -0,0 +1,268 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/base"
+	"github.com/bihua-university/alisten/internal/metrics"
+	"github.com/bihua-university/alisten/internal/semver"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket 连接中的消息类型
+const (
+	MessagePoll      = "poll"      // worker -> 服务器：还可以领取 count 个任务
+	MessageResult    = "result"    // worker -> 服务器：提交任务结果
+	MessageProgress  = "progress"  // worker -> 服务器：报告任务进度
+	MessageHeartbeat = "heartbeat" // worker -> 服务器：续约正在执行的任务
+	MessageTask      = "task"      // 服务器 -> worker：分发任务
+	MessageCancel    = "cancel"    // 服务器 -> worker：需要停止执行的任务
+	MessageAck       = "ack"       // 服务器 -> worker：结果已处理，error 不为空时表示结果被拒绝
+	MessageError     = "error"     // 服务器 -> worker：无法处理的消息
+)
+
+// Message WebSocket 连接中传输的消息，type 决定使用哪些字段
+type Message struct {
+	Type      string      `json:"type"`
+	Count     int         `json:"count,omitempty"`     // poll
+	Task      *Task       `json:"task,omitempty"`      // task
+	Result    *Result     `json:"result,omitempty"`    // result
+	Progress  *Progress   `json:"progress,omitempty"`  // progress
+	Tasks     []Heartbeat `json:"tasks,omitempty"`     // heartbeat
+	Cancelled []string    `json:"cancelled,omitempty"` // cancel
+	ID        string      `json:"id,omitempty"`        // ack
+	Error     string      `json:"error,omitempty"`     // ack, error
+}
+
+const (
+	streamPingInterval  = 25 * time.Second
+	streamPongWait      = 60 * time.Second
+	streamWriteWait     = 10 * time.Second
+	streamRenewInterval = 5 * time.Second
+	streamMaxPolls      = 64 // 单个连接同时等待的任务数上限
+)
+
+var streamUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// StreamHandler worker 的 WebSocket 连接，鉴权和版本检查与长轮询相同
+//
+// 连接建立后 worker 发送 poll 消息领取任务，服务器分发的任务都有租约，
+// 连接存活期间由服务器自动续约，连接断开时未完成的任务立即重新排队。
+func (s *Server) StreamHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.precheck(r, w) {
+		return
+	}
+	if s.isClosed() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": closedMessage})
+		return
+	}
+
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("musiclet stream upgrade", "worker", workerID(r), "error", err)
+		return
+	}
+
+	st := &stream{
+		server: s,
+		conn:   conn,
+		poller: poller{
+			id:        workerID(r),
+			remote:    r.RemoteAddr,
+			types:     parseTypes(r.URL.Query().Get("types")),
+			version:   semver.Parse(r.Header.Get("Music-Let-Version")),
+			heartbeat: true,
+		},
+		running: make(map[string]int),
+	}
+	st.serve()
+}
+
+// stream 服务器一侧的 worker WebSocket 连接
+type stream struct {
+	server  *Server
+	conn    *websocket.Conn
+	poller  poller
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	running map[string]int // 通过该连接分发、尚未提交结果的任务 ID -> 分发次数
+	polls   int            // 正在等待任务的轮询数
+
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+func (st *stream) serve() {
+	ctx, cancel := context.WithCancel(context.Background())
+	st.ctx = ctx
+	log := slog.With("worker", st.poller.id, "remote", st.poller.remote)
+	log.Info("musiclet stream connected")
+
+	_ = st.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	st.conn.SetPongHandler(func(string) error {
+		return st.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+	go st.keepalive(ctx)
+
+	for {
+		_, data, err := st.conn.ReadMessage()
+		if err != nil {
+			log.Info("musiclet stream closed", "reason", err)
+			break
+		}
+		_ = st.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+
+		var m Message
+		if err := json.Unmarshal(data, &m); err != nil {
+			st.send(Message{Type: MessageError, Error: "无效的JSON格式"})
+			continue
+		}
+		st.handle(&m)
+	}
+
+	cancel()
+	st.wg.Wait()
+	st.conn.Close()
+	// 连接断开时仍在执行的任务视为 worker 失联
+	st.server.tasks.abandon(st.beats())
+}
+
+func (st *stream) handle(m *Message) {
+	switch m.Type {
+	case MessagePoll:
+		for range max(m.Count, 1) {
+			if !st.poll() {
+				break
+			}
+		}
+	case MessageResult:
+		if m.Result == nil {
+			st.send(Message{Type: MessageError, Error: "缺少任务结果"})
+			return
+		}
+		st.mu.Lock()
+		delete(st.running, m.Result.ID)
+		st.mu.Unlock()
+		ack := Message{Type: MessageAck, ID: m.Result.ID}
+		if err := st.server.submit(st.poller.id, m.Result); err != nil {
+			ack.Error = err.Error()
+		}
+		st.send(ack)
+	case MessageProgress:
+		if m.Progress == nil {
+			st.send(Message{Type: MessageError, Error: "缺少任务进度"})
+			return
+		}
+		// 进度同时视为心跳
+		if cancelled := st.server.reportProgress(*m.Progress); len(cancelled) > 0 {
+			st.cancel(cancelled)
+		}
+	case MessageHeartbeat:
+		st.heartbeat(m.Tasks)
+	default:
+		st.send(Message{Type: MessageError, Error: "未知的消息类型: " + m.Type})
+	}
+}
+
+// poll 开始等待一个任务，等待数达到上限时返回 false
+func (st *stream) poll() bool {
+	st.mu.Lock()
+	if st.polls >= streamMaxPolls {
+		st.mu.Unlock()
+		return false
+	}
+	st.polls++
+	st.mu.Unlock()
+
+	st.wg.Add(1)
+	go func() {
+		defer st.wg.Done()
+		t := st.server.tasks.poll(st.ctx, st.poller)
+
+		st.mu.Lock()
+		st.polls--
+		if t != nil {
+			st.running[t.ID] = t.Attempt
+		}
+		st.mu.Unlock()
+		if t == nil {
+			return
+		}
+		metrics.TaskPending.Set(float64(st.server.tasks.len()))
+		slog.Debug("task dispatched", base.LogTask, t.ID, "type", t.Type, "worker", st.poller.id)
+		// 发送失败时连接已断开，任务在连接关闭时重新排队
+		st.send(Message{Type: MessageTask, Task: t})
+	}()
+	return true
+}
+
+// keepalive 定期发送 ping 并续约通过该连接分发的任务，服务器关闭时断开连接
+func (st *stream) keepalive(ctx context.Context) {
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+	renew := time.NewTicker(streamRenewInterval)
+	defer renew.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-st.server.closed:
+			msg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, closedMessage)
+			_ = st.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+			st.conn.Close()
+			return
+		case <-ping.C:
+			_ = st.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait))
+		case <-renew.C:
+			st.server.tasks.keepalive(st.poller)
+			st.heartbeat(st.beats())
+		}
+	}
+}
+
+// heartbeat 续约任务，需要取消的任务通过 cancel 消息通知 worker
+func (st *stream) heartbeat(beats []Heartbeat) {
+	if len(beats) == 0 {
+		return
+	}
+	if cancelled := st.server.tasks.heartbeat(beats); len(cancelled) > 0 {
+		st.cancel(cancelled)
+	}
+}
+
+// cancel 通知 worker 停止执行任务
+func (st *stream) cancel(cancelled []string) {
+	st.mu.Lock()
+	for _, id := range cancelled {
+		delete(st.running, id)
+	}
+	st.mu.Unlock()
+	st.send(Message{Type: MessageCancel, Cancelled: cancelled})
+}
+
+// beats 返回通过该连接分发、尚未提交结果的任务
+func (st *stream) beats() []Heartbeat {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	beats := make([]Heartbeat, 0, len(st.running))
+	for id, attempt := range st.running {
+		beats = append(beats, Heartbeat{ID: id, Attempt: attempt})
+	}
+	return beats
+}
+
+func (st *stream) send(m Message) {
+	st.writeMu.Lock()
+	defer st.writeMu.Unlock()
+	_ = st.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+	_ = st.conn.WriteJSON(m)
+}
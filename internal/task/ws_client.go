@@ -0,0 +1,166 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bihua-university/alisten/internal/syncx"
+
+	"github.com/gorilla/websocket"
+)
+
+// Stream worker 与服务器之间的 WebSocket 连接，可以代替长轮询领取任务和提交结果
+//
+// 通过 Stream 领取的任务由服务器在连接存活期间自动续约，不需要发送心跳；
+// 服务器要求取消的任务从 Cancelled 中读取。
+type Stream struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	tasks     syncx.UnboundedChan[*Task]
+	cancelled syncx.UnboundedChan[string]
+
+	done chan struct{}
+	err  error
+}
+
+// Stream 建立 WebSocket 连接，连接失败时可以退回到长轮询
+func (c *Client) Stream(ctx context.Context) (*Stream, error) {
+	u, err := neturl.Parse(c.ServerURL + "/tasks/ws")
+	if err != nil {
+		return nil, fmt.Errorf("解析服务器地址失败: %w", err)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	if len(c.Types) > 0 {
+		u.RawQuery = "types=" + neturl.QueryEscape(strings.Join(c.Types, ","))
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 10 * time.Second,
+	}
+	if t, ok := c.HTTPClient.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = t.TLSClientConfig
+	}
+	header := make(http.Header)
+	c.fillHeader(header)
+
+	conn, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("服务器返回错误状态: %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("连接失败: %w", err)
+	}
+
+	s := &Stream{
+		conn:      conn,
+		tasks:     syncx.NewUnboundedChan[*Task](8),
+		cancelled: syncx.NewUnboundedChan[string](8),
+		done:      make(chan struct{}),
+	}
+	go s.read()
+	return s, nil
+}
+
+func (s *Stream) read() {
+	defer close(s.done)
+	defer close(s.tasks.In())
+	defer close(s.cancelled.In())
+	for {
+		var m Message
+		if err := s.conn.ReadJSON(&m); err != nil {
+			s.err = err
+			return
+		}
+		switch m.Type {
+		case MessageTask:
+			if m.Task != nil {
+				s.tasks.In() <- m.Task
+			}
+		case MessageCancel:
+			for _, id := range m.Cancelled {
+				s.cancelled.In() <- id
+			}
+		case MessageAck:
+			if m.Error != "" {
+				slog.Warn("result rejected", "task", m.ID, "error", m.Error)
+			}
+		case MessageError:
+			slog.Warn("stream error", "error", m.Error)
+		}
+	}
+}
+
+// Poll 通知服务器还可以领取 n 个任务，任务从 Tasks 中读取
+func (s *Stream) Poll(n int) error {
+	return s.send(Message{Type: MessagePoll, Count: n})
+}
+
+// Tasks 服务器分发的任务，连接断开后关闭
+func (s *Stream) Tasks() <-chan *Task {
+	return s.tasks.Out()
+}
+
+// Cancelled 服务器要求停止执行的任务 ID，连接断开后关闭
+func (s *Stream) Cancelled() <-chan string {
+	return s.cancelled.Out()
+}
+
+// SubmitResult 提交任务结果
+func (s *Stream) SubmitResult(result *Result) error {
+	return s.send(Message{Type: MessageResult, Result: result})
+}
+
+// Progress 报告任务进度
+func (s *Stream) Progress(p *Progress) error {
+	return s.send(Message{Type: MessageProgress, Progress: p})
+}
+
+// Heartbeat 续约任务，需要取消的任务从 Cancelled 中读取
+func (s *Stream) Heartbeat(beats []Heartbeat) error {
+	return s.send(Message{Type: MessageHeartbeat, Tasks: beats})
+}
+
+// Done 连接断开时关闭
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err 返回连接断开的原因，连接断开前为 nil
+func (s *Stream) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close 关闭连接，未提交结果的任务会被服务器重新排队
+func (s *Stream) Close() error {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	_ = s.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	return s.conn.Close()
+}
+
+func (s *Stream) send(m Message) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := s.conn.WriteJSON(m); err != nil {
+		return fmt.Errorf("发送消息失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package task
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	s := NewServer("secret")
+	defer s.Close()
+	ts := httptest.NewServer(http.HandlerFunc(s.StreamHandler))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, "secret")
+	c.Types = []string{"a"}
+	st, err := c.Stream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if err := st.Poll(1); err != nil {
+		t.Fatal(err)
+	}
+	for !s.tasks.available("a") {
+		time.Sleep(time.Millisecond)
+	}
+
+	go func() {
+		task := <-st.Tasks()
+		_ = st.SubmitResult(&Result{ID: task.ID, Success: true})
+	}()
+	task, err := s.NewTask("a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := s.Call(task, time.Second); r == nil || !r.Success {
+		t.Fatalf("Call() = %+v, want success", r)
+	}
+	if w := s.Workers(); len(w) != 1 || w[0].Succeeded != 1 {
+		t.Errorf("Workers() = %+v, want 1 success", w)
+	}
+
+	c.Token = "wrong"
+	if _, err := c.Stream(context.Background()); err == nil {
+		t.Error("Stream() with wrong token succeeded")
+	}
+}